@@ -4,6 +4,8 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -17,6 +19,10 @@ The Nexus Repository secrets backend provides dynamic user/password based on con
 
 var Version = "v0.0.1"
 
+// minRotationPeriod is the lowest accepted automatic rotation period,
+// PeriodicFunc is not called more often than once a minute anyway
+const minRotationPeriod = time.Minute
+
 // Factory configs and returns backend
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b := newBackend()
@@ -31,32 +37,59 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 // backend defines an object that extends the Vault backend and stores the API client
 type backend struct {
 	*framework.Backend
-	client      *nxrClient
-	configMutex sync.RWMutex
-	rolesMutex  sync.RWMutex
+	clients          map[string]*nxrClient // by connection name, guarded by configMutex
+	configMutex      sync.RWMutex
+	rotationMutex    sync.Mutex // serializes the admin credential rotations and config writes, taken before configMutex
+	rolesMutex       sync.RWMutex
+	staticRolesMutex sync.RWMutex
+	cacheMutex       sync.Mutex
+	tidyMutex        sync.Mutex
+	lastAPICalls     sync.Map // by connection name, *atomic.Int64 of the last successful API call
 	// version     string
 }
 
 // newBackend create a backend
 func newBackend() *backend {
-	b := &backend{}
+	b := &backend{
+		clients: map[string]*nxrClient{},
+	}
 
 	b.Backend = &framework.Backend{
 		BackendType:    logical.TypeLogical,
 		Help:           strings.TrimSpace(backendHelp),
 		RunningVersion: Version,
 		Invalidate:     b.invalidate,
+		PeriodicFunc:   b.periodicFunc,
+
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: walRollbackMinAge,
 
 		PathsSpecial: &logical.Paths{
-			SealWrapStorage: []string{configAdminPath},
+			SealWrapStorage: []string{
+				configAdminPath,
+				configConnectionsPath,
+				staticRolesPath,
+				framework.WALPrefix,
+				userCachePath,
+			},
 		},
 		Paths: framework.PathAppend(
 			[]*framework.Path{
 				pathConfigAdmin(b),
+				pathConfigConnections(b),
+				pathConfigConnectionsList(b),
 				pathConfigRotate(b),
+				pathConfigConnectionRotate(b),
+				pathConfigTidy(b),
+				pathTidy(b),
+				pathStatus(b),
+				pathConnectionStatus(b),
 				pathCreds(b),
+				pathStaticCreds(b),
 			},
 			pathRoles(b),
+			pathStaticRoles(b),
+			pathIssued(b),
 		),
 		Secrets: []*framework.Secret{
 			nxrUserSecret(b),
@@ -66,40 +99,70 @@ func newBackend() *backend {
 	return b
 }
 
+// periodicFunc runs the backend's scheduled jobs,
+// it is called by Vault roughly once a minute
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// only the active (writable) node should touch Nexus Repository and storage
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	if err := b.rotateAdminCredentialIfDue(ctx, req.Storage); err != nil {
+		b.Logger().Error("could not rotate admin credential", "error", err)
+	}
+
+	if err := b.deleteRetiredAdminUsers(ctx, req.Storage); err != nil {
+		b.Logger().Error("could not delete previous admin users", "error", err)
+	}
+
+	if err := b.tidyIfDue(ctx, req.Storage); err != nil {
+		b.Logger().Error("could not tidy orphaned users", "error", err)
+	}
+
+	if err := b.purgeDisabledUsers(ctx, req.Storage); err != nil {
+		b.Logger().Error("could not purge disabled users", "error", err)
+	}
+
+	return b.rotateDueStaticRoles(ctx, req)
+}
+
 // invalidate clears an existing client configuration in
 // the backend
 func (b *backend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
-		b.reset()
+	switch {
+	case key == configAdminPath:
+		b.reset("")
+	case strings.HasPrefix(key, configConnectionsPath):
+		b.reset(strings.TrimPrefix(key, configConnectionsPath))
 	}
 }
 
-// reset clears any client configuration for a new
-// backend to be configured
-func (b *backend) reset() {
+// reset clears the client of the connection for a new
+// configuration to be used
+func (b *backend) reset(connection string) {
 	b.configMutex.Lock()
 	defer b.configMutex.Unlock()
-	b.client = nil
+	delete(b.clients, connection)
 }
 
 // getClient locks the backend as it configures and creates
-// a new client for the Nexus Repository API
-func (b *backend) getClient(ctx context.Context, s logical.Storage) (*nxrClient, error) {
+// a new client for the Nexus Repository API of the connection
+func (b *backend) getClient(ctx context.Context, s logical.Storage, connection string) (*nxrClient, error) {
 	b.configMutex.RLock()
 	unlockFunc := b.configMutex.RUnlock
 
 	//nolint:gocritic
 	defer func() { unlockFunc() }()
 
-	if b.client != nil {
-		return b.client, nil
+	if c, ok := b.clients[connection]; ok {
+		return c, nil
 	}
 
 	b.configMutex.RUnlock()
 	b.configMutex.Lock()
 	unlockFunc = b.configMutex.Unlock
 
-	config, err := b.fetchAdminConfig(ctx, s)
+	config, err := b.fetchAdminConfig(ctx, s, connection)
 	if err != nil {
 		return nil, err
 	}
@@ -107,10 +170,18 @@ func (b *backend) getClient(ctx context.Context, s logical.Storage) (*nxrClient,
 		config = &adminConfig{}
 	}
 
-	b.client, err = newClient(config)
+	c, err := newClient(config)
 	if err != nil {
 		return nil, err
 	}
+	c.recordCalls(b.lastAPICall(connection))
+	b.clients[connection] = c
+
+	return c, nil
+}
 
-	return b.client, nil
+// lastAPICall returns the unix time in nanoseconds of the last successful API call of the connection
+func (b *backend) lastAPICall(connection string) *atomic.Int64 {
+	last, _ := b.lastAPICalls.LoadOrStore(connection, &atomic.Int64{})
+	return last.(*atomic.Int64)
 }
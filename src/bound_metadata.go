@@ -0,0 +1,77 @@
+package nxr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/ryanuber/go-glob"
+)
+
+// hasBoundMetadata reports whether the role restricts its requesters by metadata
+func (r *nxrRoleEntry) hasBoundMetadata() bool {
+	return len(r.BoundEntityMetadata) > 0 || len(r.BoundAliasMetadata) > 0
+}
+
+// checkBoundMetadata checks that the requesting entity matches the bound metadata of the role:
+// the entity metadata must match all the bound_entity_metadata globs, and one of the entity's
+// aliases (the one of bound_alias_mount_accessor, if set) must match all the bound_alias_metadata globs
+func (r *nxrRoleEntry) checkBoundMetadata(entity *logical.Entity) error {
+	if !r.hasBoundMetadata() {
+		return nil
+	}
+
+	if entity == nil {
+		return fmt.Errorf(`role "%s" requires a requesting entity with bound metadata`, r.Name)
+	}
+
+	if key, ok := matchMetadata(r.BoundEntityMetadata, entity.Metadata); !ok {
+		return fmt.Errorf(`entity metadata "%s" does not match the bound_entity_metadata of role "%s"`, key, r.Name)
+	}
+
+	if len(r.BoundAliasMetadata) > 0 {
+		matched := slices.ContainsFunc(entity.Aliases, func(alias *logical.Alias) bool {
+			if r.BoundAliasMountAccessor != "" && alias.MountAccessor != r.BoundAliasMountAccessor {
+				return false
+			}
+			_, ok := matchMetadata(r.BoundAliasMetadata, alias.Metadata)
+			return ok
+		})
+		if !matched {
+			return fmt.Errorf(`no entity alias matches the bound_alias_metadata of role "%s"`, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// matchMetadata checks that the metadata match all the bound globs,
+// the first key which does not match is returned otherwise
+func matchMetadata(bound map[string]string, metadata map[string]string) (string, bool) {
+	keys := make([]string, 0, len(bound))
+	for key := range bound {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value, ok := metadata[key]
+		if !ok || !glob.Glob(bound[key], value) {
+			return key, false
+		}
+	}
+
+	return "", true
+}
+
+// validateBoundMetadata checks that the bound metadata have keys and patterns
+func validateBoundMetadata(name string, bound map[string]string) error {
+	for key, pattern := range bound {
+		if strings.TrimSpace(key) == "" || pattern == "" {
+			return fmt.Errorf(`"%s" must be made of "<key>=<glob>" pairs`, name)
+		}
+	}
+
+	return nil
+}
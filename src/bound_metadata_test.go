@@ -0,0 +1,150 @@
+package nxr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+func Test_BoundMetadata(t *testing.T) {
+	t.Run("BoundMetadata_Check", testBoundMetadata_Check)
+	t.Run("BoundMetadata_Creds_WithMockApi", testBoundMetadata_Creds_WithMockApi)
+}
+
+func testBoundMetadata_Check(t *testing.T) {
+	role := &nxrRoleEntry{
+		Name:                testRoleName,
+		BoundEntityMetadata: map[string]string{"team": "platform-*"},
+		BoundAliasMetadata:  map[string]string{"project_path": "group/*", "ref_protected": "true"},
+	}
+
+	testCases := []struct {
+		name          string
+		entity        *logical.Entity
+		expectedError string
+	}{
+		{
+			name: "match",
+			entity: &logical.Entity{
+				Metadata: map[string]string{"team": "platform-ci"},
+				Aliases: []*logical.Alias{
+					{Metadata: map[string]string{"project_path": "other/app", "ref_protected": "true"}},
+					{Metadata: map[string]string{"project_path": "group/app", "ref_protected": "true"}},
+				},
+			},
+		},
+		{
+			name:          "no entity",
+			expectedError: `role "test-role" requires a requesting entity with bound metadata`,
+		},
+		{
+			name: "entity metadata mismatch",
+			entity: &logical.Entity{
+				Metadata: map[string]string{"team": "security"},
+			},
+			expectedError: `entity metadata "team" does not match the bound_entity_metadata of role "test-role"`,
+		},
+		{
+			name: "alias metadata split across aliases",
+			entity: &logical.Entity{
+				Metadata: map[string]string{"team": "platform-ci"},
+				Aliases: []*logical.Alias{
+					{Metadata: map[string]string{"project_path": "group/app", "ref_protected": "false"}},
+					{Metadata: map[string]string{"project_path": "other/app", "ref_protected": "true"}},
+				},
+			},
+			expectedError: `no entity alias matches the bound_alias_metadata of role "test-role"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := role.checkBoundMetadata(tc.entity)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	// Only the alias of the bound auth mount is checked
+	role.BoundAliasMountAccessor = "auth_jwt_1"
+	entity := &logical.Entity{
+		Metadata: map[string]string{"team": "platform-ci"},
+		Aliases: []*logical.Alias{
+			{MountAccessor: "auth_userpass_2", Metadata: map[string]string{"project_path": "group/app", "ref_protected": "true"}},
+			{MountAccessor: "auth_jwt_1", Metadata: map[string]string{"project_path": "other/app", "ref_protected": "true"}},
+		},
+	}
+	assert.EqualError(t, role.checkBoundMetadata(entity), `no entity alias matches the bound_alias_metadata of role "test-role"`)
+
+	entity.Aliases[1].Metadata["project_path"] = "group/app"
+	assert.NoError(t, role.checkBoundMetadata(entity))
+}
+
+func testBoundMetadata_Creds_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Pairs without a glob are rejected
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":          testRoleNexusRoles,
+		"bound_alias_metadata": map[string]string{"project_path": ""},
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"bound_alias_metadata" must be made of "<key>=<glob>" pairs`, resp.Error().Error())
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":          testRoleNexusRoles,
+		"bound_alias_metadata": "project_path=group/*",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, rolesPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"project_path": "group/*"}, resp.Data["bound_alias_metadata"])
+
+	readCreds := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: actionRead,
+			Path:      testCredsPath,
+			Storage:   reqStorage,
+			EntityID:  "entity-ci",
+		})
+	}
+
+	// The request is denied before any user is created
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:      "entity-ci",
+		Aliases: []*logical.Alias{{Metadata: map[string]string{"project_path": "other/app"}}},
+	}
+	resp, err = readCreds()
+	require.ErrorIs(t, err, logical.ErrPermissionDenied)
+	assert.True(t, resp.IsError())
+
+	b.System().(*logical.StaticSystemView).EntityVal.Aliases[0].Metadata["project_path"] = "group/app"
+	resp, err = readCreds()
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.NotEmpty(t, resp.Data["user_id"])
+}
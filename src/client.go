@@ -1,16 +1,44 @@
 package nxr
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	nexus "github.com/datadrivers/go-nexus-client/nexus3"
 	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
 	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
 )
 
+const (
+	securityUsersEndpoint = client.BasePath + "v1/security/users"
+	securityRolesEndpoint = client.BasePath + "v1/security/roles"
+)
+
+// apiError is an unexpected response of the Nexus Repository API
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("HTTP: %d, %s", e.StatusCode, e.Body)
+}
+
 // nxrClient creates an object storing the client.
+// The API is called through its own HTTP client, built from the configuration, as the
+// library's client only takes TLS settings as file paths (and ignores the CA one).
 type nxrClient struct {
-	*nexus.NexusClient
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
 }
 
 // newClient creates a new client to access Nexus Repository
@@ -31,25 +59,249 @@ func newClient(config *adminConfig) (*nxrClient, error) {
 	if config.URL == "" {
 		return nil, errors.New("client URL was not defined")
 	}
-	c := nexus.NewClient(client.Config{
-		URL:      config.URL,
-		Username: config.Username,
-		Password: config.Password,
-		Insecure: config.Insecure,
-		Timeout:  &config.Timeout,
-	})
+	httpClient, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nxrClient{
+		url:        config.URL,
+		username:   config.Username,
+		password:   config.Password,
+		httpClient: httpClient,
+	}, nil
+}
+
+// recordCalls records the time of the client's last successful API call
+func (c *nxrClient) recordCalls(last *atomic.Int64) {
+	c.httpClient.Transport = &callRecorder{last: last, next: c.httpClient.Transport}
+}
+
+// newHTTPClient creates the HTTP client used to call the Nexus Repository API
+func newHTTPClient(config *adminConfig) (*http.Client, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := config.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateHeaders(config.Headers); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	httpClient := &http.Client{
+		Timeout:   time.Duration(config.Timeout) * time.Second,
+		Transport: transport,
+	}
+
+	if len(config.Headers) > 0 {
+		headers := http.Header{}
+		for name, value := range config.Headers {
+			headers.Set(name, value)
+		}
+		httpClient.Transport = &headerTransport{headers: headers, next: transport}
+	}
 
-	return &nxrClient{c}, nil
+	return httpClient, nil
+}
+
+// execute calls an endpoint of the API and returns the body of the response
+func (c *nxrClient) execute(method string, endpoint string, contentType string, payload io.Reader) ([]byte, *http.Response, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", c.url, endpoint), payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", client.ContentTypeApplicationJSON)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return body, resp, err
+}
+
+func (c *nxrClient) get(endpoint string) ([]byte, *http.Response, error) {
+	return c.execute(http.MethodGet, endpoint, client.ContentTypeApplicationJSON, nil)
+}
+
+func (c *nxrClient) post(endpoint string, payload io.Reader) ([]byte, *http.Response, error) {
+	return c.execute(http.MethodPost, endpoint, client.ContentTypeApplicationJSON, payload)
+}
+
+// send sends the resource as JSON to the API, an unexpected response is returned as an *apiError
+func (c *nxrClient) send(method string, endpoint string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	body, resp, err := c.execute(method, endpoint, client.ContentTypeApplicationJSON, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return nil
 }
 
 func (c *nxrClient) createUser(userCreateRequest security.User) error {
-	return c.Security.User.Create(userCreateRequest)
+	return c.send(http.MethodPost, securityUsersEndpoint, userCreateRequest)
 }
 
 func (c *nxrClient) deleteUser(userID string) error {
-	return c.Security.User.Delete(userID)
+	return c.delete(fmt.Sprintf("%s/%s", securityUsersEndpoint, url.PathEscape(userID)))
 }
 
+// changeUserPassword changes the password of the user, sent as plain text as required by the API.
 func (c *nxrClient) changeUserPassword(userID string, password string) error {
-	return c.Security.User.ChangePassword(userID, password)
+	endpoint := fmt.Sprintf("%s/%s/change-password", securityUsersEndpoint, url.PathEscape(userID))
+	body, resp, err := c.execute(http.MethodPut, endpoint, client.ContentTypeTextPlain, bytes.NewReader([]byte(password)))
+	if err != nil {
+		return fmt.Errorf("could not change password of user '%s': %w", userID, err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("could not change password of user '%s': %w", userID, &apiError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	return nil
+}
+
+// getUser returns the user, nil if it does not exist
+func (c *nxrClient) getUser(userID string) (*security.User, error) {
+	var users []security.User
+	if err := c.getJSON(fmt.Sprintf("%s?userId=%s", securityUsersEndpoint, url.QueryEscape(userID)), &users); err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if user.UserID == userID {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// disableUser sets the status of the user to disabled, a missing user is returned as a not found *apiError
+func (c *nxrClient) disableUser(userID string) error {
+	user, err := c.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return &apiError{StatusCode: http.StatusNotFound, Body: fmt.Sprintf("user '%s' not found", userID)}
+	}
+
+	user.Status = "disabled"
+	return c.send(http.MethodPut, fmt.Sprintf("%s/%s", securityUsersEndpoint, url.PathEscape(userID)), user)
+}
+
+func (c *nxrClient) createRole(role security.Role) error {
+	return c.send(http.MethodPost, securityRolesEndpoint, role)
+}
+
+func (c *nxrClient) deleteRole(roleID string) error {
+	return c.delete(fmt.Sprintf("%s/%s", securityRolesEndpoint, url.PathEscape(roleID)))
+}
+
+// delete deletes a resource of the API, an unexpected response is returned as an *apiError
+func (c *nxrClient) delete(endpoint string) error {
+	body, resp, err := c.execute(http.MethodDelete, endpoint, client.ContentTypeApplicationJSON, nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return nil
+}
+
+// authenticate checks that Nexus Repository accepts the client's credential by looking up
+// the user, a forbidden response still proves that the credential is valid
+func (c *nxrClient) authenticate(userID string) error {
+	body, resp, err := c.get(fmt.Sprintf("%s?userId=%s", securityUsersEndpoint, url.QueryEscape(userID)))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusForbidden {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return nil
+}
+
+// verifyCredential checks that Nexus Repository accepts the credential of the configuration
+func verifyCredential(config *adminConfig) error {
+	c, err := newClient(config)
+	if err != nil {
+		return err
+	}
+
+	if err := c.authenticate(config.Username); err != nil {
+		return fmt.Errorf("could not authenticate as user '%s': %w", config.Username, err)
+	}
+
+	return nil
+}
+
+// listUsers returns the local users on Nexus Repository whose ID starts with the prefix
+func (c *nxrClient) listUsers(userIDPrefix string) ([]security.User, error) {
+	var users []security.User
+	if err := c.getJSON(fmt.Sprintf("%s?source=default&userId=%s", securityUsersEndpoint, url.QueryEscape(userIDPrefix)), &users); err != nil {
+		return nil, fmt.Errorf("could not list users: %w", err)
+	}
+
+	// the search is not anchored on Nexus Repository side
+	matching := make([]security.User, 0, len(users))
+	for _, user := range users {
+		if strings.HasPrefix(user.UserID, userIDPrefix) {
+			matching = append(matching, user)
+		}
+	}
+
+	return matching, nil
+}
+
+// listRoleIDs returns the IDs of all roles existing on Nexus Repository
+func (c *nxrClient) listRoleIDs() ([]string, error) {
+	body, resp, err := c.get(securityRolesEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not list roles: %w", &apiError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var roles []security.Role
+	if err := json.Unmarshal(body, &roles); err != nil {
+		return nil, fmt.Errorf("could not unmarshal roles: %w", err)
+	}
+
+	ids := make([]string, 0, len(roles))
+	for _, role := range roles {
+		ids = append(ids, role.ID)
+	}
+
+	return ids, nil
 }
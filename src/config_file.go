@@ -0,0 +1,166 @@
+package nxr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	configFormatDockerConfigJSON = "docker_config_json"
+	configFormatNpmrc            = "npmrc"
+	configFormatMavenSettings    = "maven_settings"
+	configFormatPipConf          = "pip_conf"
+	configFormatNetrc            = "netrc"
+	configFormatGradleProperties = "gradle_properties"
+	configFormatHelmRepo         = "helm_repo"
+)
+
+// configFormats are the client config files which can be rendered for a credential
+var configFormats = []string{
+	configFormatDockerConfigJSON,
+	configFormatNpmrc,
+	configFormatMavenSettings,
+	configFormatPipConf,
+	configFormatNetrc,
+	configFormatGradleProperties,
+	configFormatHelmRepo,
+}
+
+// configFormatsWithDefaultURL are the formats which default to the Nexus Repository URL
+// when the role has no repository URL for them, as they only point at the server
+var configFormatsWithDefaultURL = []string{configFormatNetrc, configFormatGradleProperties}
+
+// validateRepositoryURLs checks that the repository URLs are keyed by a config format and absolute
+func validateRepositoryURLs(repositoryURLs map[string]string) error {
+	for format, repositoryURL := range repositoryURLs {
+		if !slices.Contains(configFormats, format) {
+			return fmt.Errorf(`"repository_urls" key "%s" must be one of "%s"`, format, strings.Join(configFormats, `", "`))
+		}
+		if u, err := url.Parse(repositoryURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf(`"repository_urls" value "%s" for "%s" is not an absolute URL`, repositoryURL, format)
+		}
+	}
+
+	return nil
+}
+
+// configFileURL returns the URL rendered in the config file of the format, an error is
+// returned if the format is unknown or no URL is configured for it
+func (r *nxrRoleEntry) configFileURL(format string, nexusURL string) (*url.URL, error) {
+	if !slices.Contains(configFormats, format) {
+		return nil, fmt.Errorf(`"format" must be one of "%s"`, strings.Join(configFormats, `", "`))
+	}
+
+	if r.CredentialType == credentialTypeNuGetAPIKey {
+		return nil, fmt.Errorf(`"format" is not supported with the "%s" credential type`, credentialTypeNuGetAPIKey)
+	}
+
+	repositoryURL, ok := r.RepositoryURLs[format]
+	if !ok && slices.Contains(configFormatsWithDefaultURL, format) {
+		repositoryURL, ok = nexusURL, true
+	}
+	if !ok {
+		return nil, fmt.Errorf(`no "repository_urls" configured for "%s" on role "%s"`, format, r.Name)
+	}
+
+	return url.Parse(repositoryURL)
+}
+
+// renderConfigFile renders the client config file of the format, authenticating with the
+// username and password (the name code and pass code of a user token) to the repository URL
+func renderConfigFile(format string, name string, repositoryURL *url.URL, username string, password string) (string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	var buf bytes.Buffer
+
+	switch format {
+	case configFormatDockerConfigJSON:
+		dockerConfig := map[string]interface{}{
+			"auths": map[string]interface{}{
+				repositoryURL.Host: map[string]string{"auth": auth},
+			},
+		}
+		data, err := json.MarshalIndent(dockerConfig, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+
+	case configFormatNpmrc:
+		registry := strings.TrimSuffix(repositoryURL.String(), "/") + "/"
+		fmt.Fprintf(&buf, "registry=%s\n", registry)
+		fmt.Fprintf(&buf, "//%s:_auth=%s\n", strings.TrimPrefix(registry, repositoryURL.Scheme+"://"), auth)
+
+	case configFormatMavenSettings:
+		buf.WriteString("<settings>\n  <servers>\n    <server>\n")
+		writeXMLElement(&buf, "      ", "id", name)
+		writeXMLElement(&buf, "      ", "username", username)
+		writeXMLElement(&buf, "      ", "password", password)
+		buf.WriteString("    </server>\n  </servers>\n  <mirrors>\n    <mirror>\n")
+		writeXMLElement(&buf, "      ", "id", name)
+		writeXMLElement(&buf, "      ", "mirrorOf", "*")
+		writeXMLElement(&buf, "      ", "url", repositoryURL.String())
+		buf.WriteString("    </mirror>\n  </mirrors>\n</settings>\n")
+
+	case configFormatPipConf:
+		indexURL := *repositoryURL
+		indexURL.User = url.UserPassword(username, password)
+		fmt.Fprintf(&buf, "[global]\nindex-url = %s\n", indexURL.String())
+
+	case configFormatNetrc:
+		fmt.Fprintf(&buf, "machine %s\nlogin %s\npassword %s\n", repositoryURL.Hostname(), netrcToken(username), netrcToken(password))
+
+	case configFormatGradleProperties:
+		fmt.Fprintf(&buf, "nexusUrl=%s\n", escapeProperty(repositoryURL.String()))
+		fmt.Fprintf(&buf, "nexusUsername=%s\n", escapeProperty(username))
+		fmt.Fprintf(&buf, "nexusPassword=%s\n", escapeProperty(password))
+
+	case configFormatHelmRepo:
+		// a JSON string is a valid YAML scalar, whatever the characters of the password
+		buf.WriteString("apiVersion: \"\"\nrepositories:\n")
+		for i, kv := range [][2]string{{"name", name}, {"url", repositoryURL.String()}, {"username", username}, {"password", password}} {
+			value, err := json.Marshal(kv[1])
+			if err != nil {
+				return "", err
+			}
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			fmt.Fprintf(&buf, "%s%s: %s\n", prefix, kv[0], value)
+		}
+
+	default:
+		return "", fmt.Errorf(`"format" must be one of "%s"`, strings.Join(configFormats, `", "`))
+	}
+
+	return buf.String(), nil
+}
+
+// writeXMLElement writes an element with the escaped text on its own line
+func writeXMLElement(buf *bytes.Buffer, indent string, name string, text string) {
+	fmt.Fprintf(buf, "%s<%s>", indent, name)
+	_ = xml.EscapeText(buf, []byte(text))
+	fmt.Fprintf(buf, "</%s>\n", name)
+}
+
+// escapeProperty escapes the characters of a value which have a meaning in a Java properties file
+func escapeProperty(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, `:`, `\:`, `#`, `\#`, `!`, `\!`).Replace(value)
+}
+
+// netrcToken quotes a value which would otherwise be split or misread in a netrc file
+// (empty, or with whitespace, a quote or a backslash), with the escapes read by curl
+func netrcToken(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n\"\\") {
+		return value
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value) + `"`
+}
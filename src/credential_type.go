@@ -0,0 +1,70 @@
+package nxr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
+)
+
+const (
+	credentialTypePassword    = "password"
+	credentialTypeUserToken   = "user_token"
+	credentialTypeNuGetAPIKey = "nuget_api_key"
+
+	// the endpoint used by the Nexus Repository UI to get an authentication token,
+	// required to access the user token and NuGet API key of the current user
+	authenticateEndpoint = client.BasePath + "wonderland/authenticate"
+)
+
+// validateCredentialType checks that the credential type is supported
+func validateCredentialType(credentialType string) error {
+	switch credentialType {
+	case "", credentialTypePassword, credentialTypeUserToken, credentialTypeNuGetAPIKey:
+		return nil
+	default:
+		return fmt.Errorf(`"credential_type" must be one of "%s", "%s" or "%s"`, credentialTypePassword, credentialTypeUserToken, credentialTypeNuGetAPIKey)
+	}
+}
+
+// newUserClient creates a client authenticated as the user, on the Nexus Repository of the configuration.
+// The user token and the NuGet API key can only be accessed by the user itself, so the user's credential is used.
+func newUserClient(config *adminConfig, userID string, password string) (*nxrClient, error) {
+	userConfig := *config
+	userConfig.Username = userID
+	userConfig.Password = password
+
+	return newClient(&userConfig)
+}
+
+// authenticationToken returns an authentication token of the client's user,
+// encoded to be passed as the `authToken` query parameter
+func (c *nxrClient) authenticationToken(userID string, password string) (string, error) {
+	authRequest, err := json.Marshal(map[string]string{
+		"u": base64.StdEncoding.EncodeToString([]byte(userID)),
+		"p": base64.StdEncoding.EncodeToString([]byte(password)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	body, resp, err := c.post(authenticateEndpoint, bytes.NewReader(authRequest))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var auth struct {
+		Token string `json:"t"`
+	}
+	if err := json.Unmarshal(body, &auth); err != nil {
+		return "", fmt.Errorf("could not unmarshal authentication token: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(auth.Token)), nil
+}
@@ -0,0 +1,102 @@
+package nxr
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	issuedUsersPath = "issued/"
+)
+
+// issuedUser records a Nexus Repository user created for a role and its requester,
+// it is kept until the user is deleted on revoke
+type issuedUser struct {
+	UserID      string    `json:"user_id"`
+	RoleName    string    `json:"role_name"`
+	CreatedAt   time.Time `json:"created_at"`
+	DisplayName string    `json:"display_name"`
+	EntityID    string    `json:"entity_id"`
+	LeaseExpiry time.Time `json:"lease_expiry"`
+
+	Connection      string `json:"connection,omitempty"`
+	EphemeralRoleID string `json:"ephemeral_role_id,omitempty"`
+}
+
+// toResponseData returns response data for an issued user
+func (u *issuedUser) toResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":      u.UserID,
+		"role_name":    u.RoleName,
+		"created_at":   u.CreatedAt,
+		"display_name": u.DisplayName,
+		"entity_id":    u.EntityID,
+		"lease_expiry": u.LeaseExpiry,
+		"connection":   u.Connection,
+	}
+}
+
+// leaseExpiry returns when the lease of the secret expires if it is not renewed
+func (b *backend) leaseExpiry(secret *logical.Secret) time.Time {
+	ttl := secret.TTL
+	if ttl <= 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+
+	return time.Now().Add(ttl)
+}
+
+// issuedUserKey returns the storage key of a user issued for a role
+func issuedUserKey(roleName string, userID string) string {
+	return issuedUsersPath + roleName + "/" + userID
+}
+
+// setIssuedUser adds the issued user to the Vault storage API
+func setIssuedUser(ctx context.Context, s logical.Storage, user *issuedUser) error {
+	entry, err := logical.StorageEntryJSON(issuedUserKey(user.RoleName, user.UserID), user)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// getIssuedUser gets the issued user from the Vault storage API
+func getIssuedUser(ctx context.Context, s logical.Storage, roleName string, userID string) (*issuedUser, error) {
+	entry, err := s.Get(ctx, issuedUserKey(roleName, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var user issuedUser
+	if err := entry.DecodeJSON(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// extendIssuedUserLease records the new lease expiry of the issued user,
+// a user shared by several leases expires with the latest one
+func extendIssuedUserLease(ctx context.Context, s logical.Storage, roleName string, userID string, leaseExpiry time.Time) error {
+	user, err := getIssuedUser(ctx, s, roleName, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !leaseExpiry.After(user.LeaseExpiry) {
+		return nil
+	}
+
+	user.LeaseExpiry = leaseExpiry
+	return setIssuedUser(ctx, s, user)
+}
+
+// deleteIssuedUser removes the issued user from the Vault storage API
+func deleteIssuedUser(ctx context.Context, s logical.Storage, roleName string, userID string) error {
+	return s.Delete(ctx, issuedUserKey(roleName, userID))
+}
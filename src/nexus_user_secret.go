@@ -3,6 +3,8 @@ package nxr
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
 	"github.com/hashicorp/vault/sdk/framework"
@@ -32,7 +34,10 @@ func nxrUserSecret(b *backend) *framework.Secret {
 
 // tokenRevoke removes the token from the Vault storage API and calls the client to revoke the robot account
 func (b *backend) nxrUserSecretRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	client, err := b.getClient(ctx, req.Storage)
+	// the user is revoked on the connection it was issued on
+	connection, _ := req.Secret.InternalData["connection"].(string)
+
+	client, err := b.getClient(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +55,67 @@ func (b *backend) nxrUserSecretRevoke(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse(`unable convert "user_id" to string`), nil
 	}
 
-	if err := client.deleteUser(userId); err != nil {
-		return logical.ErrorResponse(`error revoking Nexus Repository user "%s"`, userId), err
+	// a cached user is only deleted with its last lease
+	if cacheKeyRaw, ok := req.Secret.InternalData["cache_key"]; ok {
+		b.cacheMutex.Lock()
+		defer b.cacheMutex.Unlock()
+
+		inUse, err := releaseCachedUser(ctx, req.Storage, cacheKeyRaw.(string))
+		if err != nil {
+			return nil, err
+		}
+		if inUse {
+			return nil, nil
+		}
+	}
+
+	var roleId string
+	if roleIdRaw, ok := req.Secret.InternalData["nexus_role_id"]; ok {
+		roleId = roleIdRaw.(string)
+	}
+
+	roleName, _ := req.Secret.InternalData["role"].(string)
+
+	revocationMode := revocationModeDelete
+	if revocationModeRaw, ok := req.Secret.InternalData["revocation_mode"]; ok {
+		revocationMode = revocationModeRaw.(string)
+	}
+
+	credentialType, _ := req.Secret.InternalData["credential_type"].(string)
+
+	if revocationMode == revocationModeDelete {
+		// the role created for the user, and its user token or NuGet API key, are deleted along with it,
+		// a user already deleted (e.g. by a previous revoke attempt) is revoked
+		if err := deleteUserAndRole(ctx, client, userId, roleId); err != nil {
+			b.Logger().Error("could not revoke Nexus Repository user", "user_id", userId, "transient", isTransient(err), "error", err)
+			return logical.ErrorResponse(`error revoking Nexus Repository user "%s"`, userId), err
+		}
+	} else {
+		disabled := &disabledUser{
+			UserID:          userId,
+			RoleName:        roleName,
+			EphemeralRoleID: roleId,
+			Connection:      connection,
+			DisabledAt:      time.Now(),
+		}
+		if revocationMode == revocationModeDisableThenDelete {
+			retention, err := disabledUserRetention(req.Secret.InternalData)
+			if err != nil {
+				return nil, err
+			}
+			disabled.PurgeAt = disabled.DisabledAt.Add(retention)
+		}
+
+		if err := b.disableUser(ctx, req.Storage, client, credentialType, disabled); err != nil {
+			b.Logger().Error("could not disable Nexus Repository user", "user_id", userId, "transient", isTransient(err), "error", err)
+			return logical.ErrorResponse(`error disabling Nexus Repository user "%s"`, userId), err
+		}
+	}
+
+	if roleName != "" {
+		if err := deleteIssuedUser(ctx, req.Storage, roleName, userId); err != nil {
+			return nil, err
+		}
 	}
 
 	return nil, nil
@@ -80,10 +144,25 @@ func (b *backend) nxrUserSecretRenew(ctx context.Context, req *logical.Request,
 	if roleEntry.TTL > 0 {
 		resp.Secret.TTL = roleEntry.TTL
 	}
-	if roleEntry.MaxTTL > 0 {
+	// the ttl requested with the creds overrides the role's one
+	if ttlRaw, ok := req.Secret.InternalData["ttl"]; ok {
+		ttl, err := time.ParseDuration(ttlRaw.(string))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the ttl of the lease: %w", err)
+		}
+		resp.Secret.TTL = ttl
+	}
+	// leases of a cached user keep the max TTL capped to the cache expiration
+	if _, cached := req.Secret.InternalData["cache_key"]; !cached && roleEntry.MaxTTL > 0 {
 		resp.Secret.MaxTTL = roleEntry.MaxTTL
 	}
 
+	if userIdRaw, ok := req.Secret.InternalData["user_id"]; ok {
+		if err := extendIssuedUserLease(ctx, req.Storage, role, userIdRaw.(string), b.leaseExpiry(resp.Secret)); err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
 
@@ -92,6 +171,17 @@ type nxrUser struct {
 	Password   string   `json:"password" mapstructure:"password"`
 	Email      string   `json:"email_address" mapstructure:"email_address"`
 	NexusRoles []string `json:"nexus_roles" mapstructure:"nexus_roles"`
+	FirstName  string   `json:"first_name,omitempty" mapstructure:"-"`
+	LastName   string   `json:"last_name,omitempty" mapstructure:"-"`
+
+	// EphemeralRoleID is the role created on Nexus Repository for the user only
+	EphemeralRoleID string `json:"ephemeral_role_id,omitempty" mapstructure:"-"`
+
+	// Token is the user token returned instead of the password, if set
+	Token *userToken `json:"user_token,omitempty" mapstructure:"-"`
+
+	// NuGetAPIKey is the NuGet API key returned instead of the password, if set
+	NuGetAPIKey string `json:"nuget_api_key,omitempty" mapstructure:"-"`
 }
 
 func (u *nxrUser) toResponseData() (map[string]interface{}, error) {
@@ -100,14 +190,27 @@ func (u *nxrUser) toResponseData() (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	// the password is never returned along with a user token
+	if u.Token != nil {
+		delete(respData, "password")
+		respData["name_code"] = u.Token.NameCode
+		respData["pass_code"] = u.Token.PassCode
+	}
+
+	// nor along with a NuGet API key
+	if u.NuGetAPIKey != "" {
+		delete(respData, "password")
+		respData["nuget_api_key"] = u.NuGetAPIKey
+	}
+
 	return respData, nil
 }
 
 func createNxrUser(c *nxrClient, u *nxrUser) error {
 	userCreateRequest := security.User{
 		UserID:       u.UserID,
-		FirstName:    u.UserID,
-		LastName:     u.UserID,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
 		EmailAddress: u.Email,
 		Password:     u.Password,
 		Roles:        u.NexusRoles,
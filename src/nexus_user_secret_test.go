@@ -1,9 +1,15 @@
 package nxr
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -13,6 +19,17 @@ import (
 func Test_Secrets(t *testing.T) {
 	t.Run("Secret_WithMockApi", testScret_WithMockApi)
 	t.Run("Secret_WithMockApi_Fail", testScret_WithMockApi_Fail)
+	t.Run("Secret_Revoke_WithMockApi", testSecret_Revoke_WithMockApi)
+	t.Run("Secret_Revoke_Disable_WithMockApi", testSecret_Revoke_Disable_WithMockApi)
+}
+
+// setTestRetryDelays shortens the delays between retries for the test
+func setTestRetryDelays(t *testing.T) {
+	baseDelay, maxDelay := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = time.Millisecond, 2*time.Millisecond
+	t.Cleanup(func() {
+		retryBaseDelay, retryMaxDelay = baseDelay, maxDelay
+	})
 }
 
 func testScret_WithMockApi(t *testing.T) {
@@ -24,9 +41,10 @@ func testScret_WithMockApi(t *testing.T) {
 	})(t)
 
 	config := &testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      mockSrv.URL(),
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
 	}
 	// Create base config
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, *config)
@@ -66,6 +84,7 @@ func testScret_WithMockApi(t *testing.T) {
 
 func testScret_WithMockApi_Fail(t *testing.T) {
 	b, reqStorage := getTestBackend(t)
+	setTestRetryDelays(t)
 
 	mockSrv := httpmock.New(func(s *httpmock.Server) {
 		s.ExpectPost(userCreateURI).
@@ -73,9 +92,10 @@ func testScret_WithMockApi_Fail(t *testing.T) {
 	})(t)
 
 	config := &testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      mockSrv.URL(),
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
 	}
 	// Create base config
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, *config)
@@ -103,9 +123,166 @@ func testScret_WithMockApi_Fail(t *testing.T) {
 	//
 	userID := resp.Secret.InternalData["user_id"].(string)
 	mockSrv.ExpectDelete(fmt.Sprintf(userURI, userID)). // update client URI
-								ReturnCode(httpmock.StatusBadGateway)
-	// Run test revoke, expect error
+								ReturnCode(httpmock.StatusBadGateway).
+								Times(uint(retryMaxAttempts))
+	// Run test revoke, expect error once the retries are exhausted
 	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
 	require.Error(t, err)
 	assert.NotNil(t, resp)
 }
+
+func testSecret_Revoke_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	setTestRetryDelays(t)
+
+	mockSrv := httpmock.New()(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// A transient error is retried
+	mockSrv.ExpectPost(userCreateURI)
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"])).
+		ReturnCode(httpmock.StatusServiceUnavailable)
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"])).
+		ReturnCode(httpmock.StatusNoContent)
+
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// A user already deleted is revoked
+	mockSrv.ExpectPost(userCreateURI)
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"])).
+		ReturnCode(httpmock.StatusNotFound)
+
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// A permanent error is not retried
+	mockSrv.ExpectPost(userCreateURI)
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"])).
+		ReturnCode(httpmock.StatusForbidden)
+
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.Error(t, err)
+	assert.True(t, resp.IsError())
+
+	// Nor is a response which cannot be decoded
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"revocation_mode": revocationModeDisable,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	mockSrv.ExpectPost(userCreateURI)
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	mockSrv.ExpectGet(fmt.Sprintf(userGetURI, resp.Data["user_id"])).
+		Return("not json")
+
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.Error(t, err)
+	assert.True(t, resp.IsError())
+}
+
+func testSecret_Revoke_Disable_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":             testRoleNexusRoles,
+		"revocation_mode":         revocationModeDisableThenDelete,
+		"disabled_user_retention": "1h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	creds, err := doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, creds.Error())
+	userID := creds.Data["user_id"].(string)
+
+	// The retention of the role when the credential was issued applies
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"disabled_user_retention": "2h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The user is disabled instead of deleted
+	var updatedUser security.User
+	mockSrv.ExpectGet(fmt.Sprintf(userGetURI, userID)).
+		Run(returnRequestedUser)
+	mockSrv.ExpectPut(fmt.Sprintf(userURI, userID)).
+		Run(func(r *http.Request) ([]byte, error) {
+			return nil, json.NewDecoder(r.Body).Decode(&updatedUser)
+		})
+
+	resp, err = doSecretAction(actionRevoke, creds.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, "disabled", updatedUser.Status)
+
+	disabled, err := getDisabledUser(context.Background(), reqStorage, userID)
+	require.NoError(t, err)
+	require.NotNil(t, disabled)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), disabled.PurgeAt, time.Minute)
+
+	// The user is kept during the retention
+	resp, err = doAction(logical.RollbackOperation, "", b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The user is purged once the retention has elapsed, even if
+	// a user of a connection without client is listed before it
+	disabled.PurgeAt = time.Now().Add(-time.Minute)
+	require.NoError(t, setDisabledUser(context.Background(), reqStorage, disabled))
+	unmanaged := &disabledUser{UserID: "a-unmanaged", Connection: "gone", PurgeAt: disabled.PurgeAt}
+	require.NoError(t, setDisabledUser(context.Background(), reqStorage, unmanaged))
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, userID))
+
+	resp, err = doAction(logical.RollbackOperation, "", b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	disabled, err = getDisabledUser(context.Background(), reqStorage, userID)
+	require.NoError(t, err)
+	assert.Nil(t, disabled)
+
+	// The user of the connection without client is kept to be retried
+	unmanaged, err = getDisabledUser(context.Background(), reqStorage, unmanaged.UserID)
+	require.NoError(t, err)
+	assert.NotNil(t, unmanaged)
+}
@@ -0,0 +1,64 @@
+package nxr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
+)
+
+const (
+	// the endpoint used by the Nexus Repository UI to access the NuGet API key of the current user
+	nugetAPIKeyEndpoint = client.BasePath + "internal/nuget-api-key"
+)
+
+// issueNuGetAPIKey returns the NuGet API key of the user, it is created on first access.
+func issueNuGetAPIKey(config *adminConfig, userID string, password string) (string, error) {
+	c, err := newUserClient(config, userID, password)
+	if err != nil {
+		return "", err
+	}
+
+	authToken, err := c.authenticationToken(userID, password)
+	if err != nil {
+		return "", fmt.Errorf("could not get NuGet API key of user '%s': %w", userID, err)
+	}
+
+	body, resp, err := c.get(fmt.Sprintf("%s?authToken=%s", nugetAPIKeyEndpoint, url.QueryEscape(authToken)))
+	if err != nil {
+		return "", fmt.Errorf("could not get NuGet API key of user '%s': %w", userID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get NuGet API key of user '%s': %w", userID, &apiError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var key struct {
+		APIKey string `json:"apiKey"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		return "", fmt.Errorf("could not unmarshal NuGet API key: %w", err)
+	}
+
+	return key.APIKey, nil
+}
+
+// deleteNuGetAPIKey deletes the NuGet API key of the user, a new one is created on next access.
+func deleteNuGetAPIKey(config *adminConfig, userID string, password string) error {
+	c, err := newUserClient(config, userID, password)
+	if err != nil {
+		return err
+	}
+
+	authToken, err := c.authenticationToken(userID, password)
+	if err != nil {
+		return fmt.Errorf("could not delete NuGet API key of user '%s': %w", userID, err)
+	}
+
+	if err := c.delete(fmt.Sprintf("%s?authToken=%s", nugetAPIKeyEndpoint, url.QueryEscape(authToken))); err != nil && !isNotFound(err) {
+		return fmt.Errorf("could not delete NuGet API key of user '%s': %w", userID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	nugetAPIKeyURIRegex = `^/service/rest/internal/nuget-api-key\?authToken=`
+	testNuGetAPIKey     = "2ba3a3e4-b1f5-3a8e-9b8c-3b8a0e1c5d7f"
+)
+
+func Test_NuGetAPIKey(t *testing.T) {
+	t.Run("NuGetAPIKey_Creds_WithMockApi", testNuGetAPIKey_Creds_WithMockApi)
+	t.Run("NuGetAPIKey_Revoke_Disable_WithMockApi", testNuGetAPIKey_Revoke_Disable_WithMockApi)
+	t.Run("NuGetAPIKey_StaticRole_WithMockApi", testNuGetAPIKey_StaticRole_WithMockApi)
+	t.Run("NuGetAPIKey_Fail", testNuGetAPIKey_Fail)
+}
+
+// expectNuGetAPIKey mocks the access to the NuGet API key of the current user
+func expectNuGetAPIKey(s *httpmock.Server) {
+	s.ExpectPost(authenticateURI).
+		Return(testUserTokenAuthRsp)
+	s.ExpectGet(httpmock.RegexPattern(nugetAPIKeyURIRegex)).
+		ReturnJSON(map[string]string{"apiKey": testNuGetAPIKey})
+}
+
+// expectNuGetAPIKeyDelete mocks the deletion of the NuGet API key of the current user
+func expectNuGetAPIKeyDelete(s *httpmock.Server) {
+	s.ExpectPost(authenticateURI).
+		Return(testUserTokenAuthRsp)
+	s.ExpectDelete(httpmock.RegexPattern(nugetAPIKeyURIRegex)).
+		ReturnCode(httpmock.StatusNoContent)
+}
+
+func testNuGetAPIKey_Creds_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		expectNuGetAPIKey(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeNuGetAPIKey,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testNuGetAPIKey, resp.Data["nuget_api_key"])
+	assert.NotContains(t, resp.Data, "password")
+
+	// The key is deleted along with the user
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"]))
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testNuGetAPIKey_Revoke_Disable_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		expectNuGetAPIKey(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeNuGetAPIKey,
+		"revocation_mode": revocationModeDisable,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	creds, err := doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, creds.Error())
+	userID := creds.Data["user_id"].(string)
+
+	// The key is deleted by the user, with a new password, before the user is disabled
+	mockSrv.ExpectGet(fmt.Sprintf(userGetURI, userID)).
+		Run(returnRequestedUser)
+	mockSrv.ExpectPut(fmt.Sprintf(userChangePasswordURI, userID))
+	expectNuGetAPIKeyDelete(mockSrv)
+	mockSrv.ExpectGet(fmt.Sprintf(userGetURI, userID)).
+		Run(returnRequestedUser)
+	mockSrv.ExpectPut(fmt.Sprintf(userURI, userID))
+
+	resp, err = doSecretAction(actionRevoke, creds.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	disabled, err := getDisabledUser(context.Background(), reqStorage, userID)
+	require.NoError(t, err)
+	assert.NotNil(t, disabled)
+}
+
+func testNuGetAPIKey_StaticRole_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID))
+		expectNuGetAPIKeyDelete(s)
+		expectNuGetAPIKey(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id":         testStaticRoleUserID,
+		"credential_type": credentialTypeNuGetAPIKey,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, staticCredsPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testStaticRoleUserID, resp.Data["user_id"])
+	assert.Equal(t, testNuGetAPIKey, resp.Data["nuget_api_key"])
+	assert.NotContains(t, resp.Data, "password")
+}
+
+func testNuGetAPIKey_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		// the NuGet API-Key realm is not enabled
+		s.ExpectPost(authenticateURI).
+			Return(testUserTokenAuthRsp)
+		s.ExpectGet(httpmock.RegexPattern(nugetAPIKeyURIRegex)).
+			ReturnCode(httpmock.StatusForbidden)
+		// The user is rolled back
+		s.ExpectDelete(httpmock.RegexPattern(`^/service/rest/v1/security/users/v-test-role-`))
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeNuGetAPIKey,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "could not get NuGet API key of Nexus Repository user")
+}
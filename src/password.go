@@ -0,0 +1,147 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	gopw "github.com/sethvargo/go-password/password"
+)
+
+const (
+	defaultPasswordLength  = 64
+	defaultPasswordDigits  = 10
+	defaultPasswordSymbols = 0
+)
+
+// passwordConfig defines how passwords are generated, either from a Vault
+// password policy (sys/policies/password) or from the inline settings.
+// The numbers of digits and symbols are nil when not set, as 0 is a valid setting.
+type passwordConfig struct {
+	PasswordPolicy        string `json:"password_policy,omitempty" mapstructure:"password_policy"`
+	PasswordLength        int    `json:"password_length,omitempty" mapstructure:"password_length"`
+	PasswordDigits        *int   `json:"password_digits,omitempty" mapstructure:"password_digits"`
+	PasswordSymbols       *int   `json:"password_symbols,omitempty" mapstructure:"password_symbols"`
+	PasswordSymbolCharset string `json:"password_symbol_charset,omitempty" mapstructure:"password_symbol_charset"`
+}
+
+// withPasswordFields adds the field schemas of the password generation settings to the fields
+func withPasswordFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	for k, v := range map[string]*framework.FieldSchema{
+		"password_policy": {
+			Type:        framework.TypeString,
+			Description: "Optional. Name of the Vault password policy (sys/policies/password) used to generate passwords. Takes precedence over the inline password settings.",
+		},
+		"password_length": {
+			Type:        framework.TypeInt,
+			Description: fmt.Sprintf("Optional. Length of generated passwords, when no password policy is set. Default to %d.", defaultPasswordLength),
+		},
+		"password_digits": {
+			Type:        framework.TypeInt,
+			Description: fmt.Sprintf("Optional. Number of digits in generated passwords, when no password policy is set. Default to %d.", defaultPasswordDigits),
+		},
+		"password_symbols": {
+			Type:        framework.TypeInt,
+			Description: fmt.Sprintf("Optional. Number of symbols in generated passwords, when no password policy is set. Default to %d.", defaultPasswordSymbols),
+		},
+		"password_symbol_charset": {
+			Type:        framework.TypeString,
+			Description: fmt.Sprintf("Optional. Symbols allowed in generated passwords, when no password policy is set. Default to `%s`.", gopw.Symbols),
+		},
+	} {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// update sets the password generation settings from the request data
+func (p *passwordConfig) update(d *framework.FieldData) {
+	if passwordPolicy, ok := d.GetOk("password_policy"); ok {
+		p.PasswordPolicy = passwordPolicy.(string)
+	}
+
+	if passwordLength, ok := d.GetOk("password_length"); ok {
+		p.PasswordLength = passwordLength.(int)
+	}
+
+	if passwordDigits, ok := d.GetOk("password_digits"); ok {
+		digits := passwordDigits.(int)
+		p.PasswordDigits = &digits
+	}
+
+	if passwordSymbols, ok := d.GetOk("password_symbols"); ok {
+		symbols := passwordSymbols.(int)
+		p.PasswordSymbols = &symbols
+	}
+
+	if passwordSymbolCharset, ok := d.GetOk("password_symbol_charset"); ok {
+		p.PasswordSymbolCharset = passwordSymbolCharset.(string)
+	}
+}
+
+// toResponseData returns the password generation settings which are set
+func (p *passwordConfig) toResponseData() map[string]interface{} {
+	respData := map[string]interface{}{}
+
+	if p.PasswordPolicy != "" {
+		respData["password_policy"] = p.PasswordPolicy
+	}
+	if p.PasswordLength != 0 {
+		respData["password_length"] = p.PasswordLength
+	}
+	if p.PasswordDigits != nil {
+		respData["password_digits"] = *p.PasswordDigits
+	}
+	if p.PasswordSymbols != nil {
+		respData["password_symbols"] = *p.PasswordSymbols
+	}
+	if p.PasswordSymbolCharset != "" {
+		respData["password_symbol_charset"] = p.PasswordSymbolCharset
+	}
+
+	return respData
+}
+
+// generatePassword generates a random password according to the password generation settings
+func (b *backend) generatePassword(ctx context.Context, p passwordConfig) (string, error) {
+	if p.PasswordPolicy != "" {
+		return b.System().GeneratePasswordFromPolicy(ctx, p.PasswordPolicy)
+	}
+
+	length, digits, symbols := defaultPasswordLength, defaultPasswordDigits, defaultPasswordSymbols
+	if p.PasswordLength != 0 {
+		length = p.PasswordLength
+	}
+	if p.PasswordDigits != nil {
+		digits = *p.PasswordDigits
+	}
+	if p.PasswordSymbols != nil {
+		symbols = *p.PasswordSymbols
+	}
+
+	generator, err := gopw.NewGenerator(&gopw.GeneratorInput{
+		Symbols: p.PasswordSymbolCharset,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return generator.Generate(length, digits, symbols, false, true)
+}
+
+// validatePasswordConfig checks that passwords can be generated with the settings
+func (b *backend) validatePasswordConfig(ctx context.Context, p passwordConfig) error {
+	if p.PasswordLength < 0 || (p.PasswordDigits != nil && *p.PasswordDigits < 0) || (p.PasswordSymbols != nil && *p.PasswordSymbols < 0) {
+		return fmt.Errorf(`"password_length", "password_digits" and "password_symbols" cannot be negative`)
+	}
+
+	if _, err := b.generatePassword(ctx, p); err != nil {
+		if p.PasswordPolicy != "" {
+			return fmt.Errorf(`unable to generate password from "password_policy" "%s": %w`, p.PasswordPolicy, err)
+		}
+		return fmt.Errorf("unable to generate password from the password settings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package nxr
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPasswordPolicy         = "nexus-policy"
+	testPasswordPolicyPassword = "from-the-password-policy"
+)
+
+func Test_Password(t *testing.T) {
+	t.Run("Password_Generate", testPassword_Generate)
+	t.Run("Password_Validate_Fail", testPassword_Validate_Fail)
+	t.Run("Password_RoleConfig", testPassword_RoleConfig)
+}
+
+func setTestPasswordPolicy(b *backend) {
+	b.System().(*logical.StaticSystemView).SetPasswordPolicy(testPasswordPolicy, func() (string, error) {
+		return testPasswordPolicyPassword, nil
+	})
+}
+
+func testPassword_Generate(t *testing.T) {
+	b, _ := getTestBackend(t)
+	setTestPasswordPolicy(b)
+	ctx := context.Background()
+
+	// Defaults
+	pw, err := b.generatePassword(ctx, passwordConfig{})
+	require.NoError(t, err)
+	assert.Len(t, pw, defaultPasswordLength)
+
+	// Password policy takes precedence over the inline settings
+	pw, err = b.generatePassword(ctx, passwordConfig{
+		PasswordPolicy: testPasswordPolicy,
+		PasswordLength: 10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testPasswordPolicyPassword, pw)
+
+	// Inline settings
+	digits, symbols := 20, 30
+	pw, err = b.generatePassword(ctx, passwordConfig{
+		PasswordLength:        128,
+		PasswordDigits:        &digits,
+		PasswordSymbols:       &symbols,
+		PasswordSymbolCharset: "_-",
+	})
+	require.NoError(t, err)
+	assert.Len(t, pw, 128)
+	assert.Equal(t, 30, strings.Count(pw, "_")+strings.Count(pw, "-"))
+
+	// No digits is not the default
+	digits = 0
+	pw, err = b.generatePassword(ctx, passwordConfig{
+		PasswordDigits: &digits,
+	})
+	require.NoError(t, err)
+	assert.NotRegexp(t, `[0-9]`, pw)
+}
+
+func testPassword_Validate_Fail(t *testing.T) {
+	b, _ := getTestBackend(t)
+	ctx := context.Background()
+
+	testCases := []struct {
+		config        passwordConfig
+		expectedError string
+	}{
+		{
+			config:        passwordConfig{PasswordPolicy: "unknown"},
+			expectedError: `unable to generate password from "password_policy" "unknown": password policy not found`,
+		},
+		{
+			config:        passwordConfig{PasswordLength: -1},
+			expectedError: `"password_length", "password_digits" and "password_symbols" cannot be negative`,
+		},
+		{
+			config:        passwordConfig{PasswordLength: 8},
+			expectedError: `unable to generate password from the password settings: number of digits and symbols must be less than total length`,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := b.validatePasswordConfig(ctx, tc.config)
+		require.Error(t, err)
+		assert.Equal(t, tc.expectedError, err.Error())
+	}
+}
+
+func testPassword_RoleConfig(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	setTestPasswordPolicy(b)
+
+	resp, err := initBaseAdminConfig(b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"password_policy": testPasswordPolicy,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, rolesPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testPasswordPolicy, resp.Data["password_policy"])
+
+	// The number of digits can be set back to 0
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"password_digits": 5,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"password_digits": 0,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, rolesPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, 0, resp.Data["password_digits"])
+
+	// Unknown password policy
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"password_policy": "unknown",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	// Unknown password policy in the admin config
+	resp, err = doAction(actionUpdate, configAdminPath, b, reqStorage, testData{
+		"password_policy": "unknown",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+}
@@ -2,9 +2,14 @@ package nxr
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/template"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/robfig/cron/v3"
 )
 
 const (
@@ -21,6 +26,57 @@ type adminConfig struct {
 	URL      string `json:"url"`
 	Insecure bool   `json:"insecure,omitempty"`
 	Timeout  int    `json:"timeout,omitempty"`
+
+	CACert        string `json:"ca_cert,omitempty"`
+	ClientCert    string `json:"client_cert,omitempty"`
+	ClientKey     string `json:"client_key,omitempty"`
+	TLSServerName string `json:"tls_server_name,omitempty"`
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	ProxyURL string            `json:"proxy_url,omitempty"`
+	NoProxy  string            `json:"no_proxy,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+
+	RotationPeriod         time.Duration `json:"rotation_period,omitempty"`
+	RotationSchedule       string        `json:"rotation_schedule,omitempty"`
+	RotationMode           string        `json:"rotation_mode,omitempty"`
+	RotationUserIdTemplate string        `json:"rotation_user_id_template,omitempty"`
+	LastRotated            time.Time     `json:"last_rotated,omitempty"`
+	NextRotation           time.Time     `json:"next_rotation,omitempty"`
+
+	passwordConfig
+}
+
+// hasAutoRotation returns true if the admin's password should be rotated automatically
+func (c *adminConfig) hasAutoRotation() bool {
+	return c.RotationPeriod > 0 || c.RotationSchedule != ""
+}
+
+// scheduleNextRotation computes the next automatic rotation time,
+// based on the last rotation (or now if the password was never rotated)
+func (c *adminConfig) scheduleNextRotation() error {
+	if !c.hasAutoRotation() {
+		c.NextRotation = time.Time{}
+		return nil
+	}
+
+	from := c.LastRotated
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	if c.RotationPeriod > 0 {
+		c.NextRotation = from.Add(c.RotationPeriod)
+		return nil
+	}
+
+	schedule, err := cron.ParseStandard(c.RotationSchedule)
+	if err != nil {
+		return err
+	}
+	c.NextRotation = schedule.Next(from)
+
+	return nil
 }
 
 // pathConfigAdmin extends the Vault API with a `config/admin`
@@ -28,53 +84,7 @@ type adminConfig struct {
 func pathConfigAdmin(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: configAdminPath,
-		Fields: map[string]*framework.FieldSchema{
-			"username": {
-				Type:        framework.TypeLowerCaseString,
-				Description: "The username to access Nexus Repository API.",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Username",
-					Sensitive: false,
-				},
-			},
-			"password": {
-				Type:        framework.TypeString,
-				Description: "The user's password to access Nexus Repository API.",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Password",
-					Sensitive: true,
-				},
-			},
-			"url": {
-				Type:        framework.TypeLowerCaseString,
-				Description: "The URL for the Nexus Repository API.",
-				Required:    true,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "URL",
-					Sensitive: false,
-				},
-			},
-			"insecure": {
-				Type:        framework.TypeBool,
-				Default:     defaultInsecure,
-				Description: "Optional. Bypass certification verification for TLS connection with Nexus Repository API. Default to `false`.",
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Insecure",
-					Sensitive: false,
-				},
-			},
-			"timeout": {
-				Type:        framework.TypeDurationSecond,
-				Default:     defaultTimeout,
-				Description: "Optional. Timeout for connection with Nexus Repository API. Default to `30s` (30 seconds).",
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Timeout",
-					Sensitive: false,
-				},
-			},
-		},
+		Fields:  adminConfigFields(),
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.pathConfigAdminRead,
@@ -99,6 +109,166 @@ func pathConfigAdmin(b *backend) *framework.Path {
 	}
 }
 
+// adminConfigFields returns the fields of an admin configuration,
+// shared by `config/admin` and the named connections
+func adminConfigFields() map[string]*framework.FieldSchema {
+	return withPasswordFields(map[string]*framework.FieldSchema{
+		"username": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "The username to access Nexus Repository API.",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Username",
+				Sensitive: false,
+			},
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "The user's password to access Nexus Repository API.",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Password",
+				Sensitive: true,
+			},
+		},
+		"url": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "The URL for the Nexus Repository API.",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "URL",
+				Sensitive: false,
+			},
+		},
+		"insecure": {
+			Type:        framework.TypeBool,
+			Default:     defaultInsecure,
+			Description: "Optional. Bypass certification verification for TLS connection with Nexus Repository API. Default to `false`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Insecure",
+				Sensitive: false,
+			},
+		},
+		"timeout": {
+			Type:        framework.TypeDurationSecond,
+			Default:     defaultTimeout,
+			Description: "Optional. Timeout for connection with Nexus Repository API. Default to `30s` (30 seconds).",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Timeout",
+				Sensitive: false,
+			},
+		},
+		"ca_cert": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded CA certificate(s) to verify the TLS certificate of Nexus Repository, trusted along with the system ones.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "CA certificate",
+				Sensitive: false,
+			},
+		},
+		"client_cert": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded client certificate for mTLS with Nexus Repository (or its reverse proxy). Requires `client_key`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Client certificate",
+				Sensitive: false,
+			},
+		},
+		"client_key": {
+			Type:        framework.TypeString,
+			Description: "Optional. PEM encoded private key of the client certificate. Requires `client_cert`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Client key",
+				Sensitive: true,
+			},
+		},
+		"tls_server_name": {
+			Type:        framework.TypeString,
+			Description: "Optional. Server name to verify the TLS certificate of Nexus Repository against, and to send as SNI. Default to the host of `url`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "TLS server name",
+				Sensitive: false,
+			},
+		},
+		"tls_min_version": {
+			Type:          framework.TypeString,
+			Default:       defaultTLSMinVersion,
+			Description:   "Optional. Minimum TLS version of the connection with Nexus Repository: `tls10`, `tls11`, `tls12` or `tls13`. Default to `tls12`.",
+			AllowedValues: []interface{}{"tls10", "tls11", "tls12", "tls13"},
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "TLS minimum version",
+				Sensitive: false,
+			},
+		},
+		"proxy_url": {
+			Type:        framework.TypeString,
+			Description: "Optional. URL of the HTTP(S) proxy to reach Nexus Repository through (e.g. `http://proxy.example.org:3128`). Default to the proxy of the environment (`HTTPS_PROXY`, `HTTP_PROXY` and `NO_PROXY`).",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Proxy URL",
+				Sensitive: false,
+			},
+		},
+		"no_proxy": {
+			Type:        framework.TypeString,
+			Description: "Optional. Comma-separated hosts, domains and CIDRs reached without `proxy_url`, with the `NO_PROXY` syntax.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "No proxy",
+				Sensitive: false,
+			},
+		},
+		"headers": {
+			Type:        framework.TypeKVPairs,
+			Description: "Optional. Headers added to every request to Nexus Repository, as \"<name>=<value>\" pairs (e.g. a WAF bypass token). Their values are not returned.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Headers",
+				Sensitive: true,
+			},
+		},
+		"verify_connection": {
+			Type:        framework.TypeBool,
+			Default:     true,
+			Description: "Optional. Verify that Nexus Repository is reachable, that the credential authenticates and that the user holds the privileges to manage users, before the configuration is stored. Default to `true`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Verify connection",
+				Sensitive: false,
+			},
+		},
+		"rotation_period": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Optional. Period for automatically rotating the admin's password. Mutually exclusive with `rotation_schedule`. Default to `0` (disabled), minimum `1m`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Rotation period",
+				Sensitive: false,
+			},
+		},
+		"rotation_schedule": {
+			Type:        framework.TypeString,
+			Description: "Optional. Cron-style schedule (e.g. `0 0 1 * *`) for automatically rotating the admin's password. Mutually exclusive with `rotation_period`.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Rotation schedule",
+				Sensitive: false,
+			},
+		},
+		"rotation_mode": {
+			Type:          framework.TypeString,
+			Description:   "Optional. How the admin credential is rotated: `password` changes the admin's password, `clone_user` creates a new user with the same roles then deletes the current one. Default to `password`.",
+			AllowedValues: []interface{}{rotationModePassword, rotationModeCloneUser},
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Rotation mode",
+				Sensitive: false,
+			},
+		},
+		"rotation_user_id_template": {
+			Type:        framework.TypeString,
+			Description: fmt.Sprintf("Optional. Template to generate the ID of the new admin user in `clone_user` rotation mode. Default to %s.", defaultRotationUserIdTemplate),
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Rotation user ID template",
+				Sensitive: false,
+			},
+		},
+	})
+}
+
 // pathExistenceCheck verifies if the configuration of path exists.
 func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
 	out, err := req.Storage.Get(ctx, req.Path)
@@ -114,30 +284,101 @@ func (b *backend) pathConfigAdminRead(ctx context.Context, req *logical.Request,
 	b.configMutex.Lock()
 	defer b.configMutex.Unlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	connection := connectionName(data)
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
+		return adminConfigNotFound(connection), nil
+	}
+
+	respData := map[string]interface{}{
+		"username": config.Username,
+		"url":      config.URL,
+		"insecure": config.Insecure,
+		"timeout":  config.Timeout,
+	}
+
+	// the client key is never returned
+	if config.CACert != "" {
+		respData["ca_cert"] = config.CACert
+	}
+
+	if config.ClientCert != "" {
+		respData["client_cert"] = config.ClientCert
+	}
+
+	if config.TLSServerName != "" {
+		respData["tls_server_name"] = config.TLSServerName
+	}
+
+	if config.TLSMinVersion != "" {
+		respData["tls_min_version"] = config.TLSMinVersion
+	}
+
+	if config.ProxyURL != "" {
+		respData["proxy_url"] = config.ProxyURL
+	}
+
+	if config.NoProxy != "" {
+		respData["no_proxy"] = config.NoProxy
+	}
+
+	// the header values may be secrets, only their names are returned
+	if len(config.Headers) > 0 {
+		names := make([]string, 0, len(config.Headers))
+		for name := range config.Headers {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		respData["headers"] = names
+	}
+
+	// Automatic rotation details are only shown when relevant
+	if config.RotationPeriod > 0 {
+		respData["rotation_period"] = int64(config.RotationPeriod.Seconds())
+	}
+
+	if config.RotationSchedule != "" {
+		respData["rotation_schedule"] = config.RotationSchedule
+	}
+
+	if config.RotationMode != "" {
+		respData["rotation_mode"] = config.RotationMode
+	}
+
+	if config.RotationUserIdTemplate != "" {
+		respData["rotation_user_id_template"] = config.RotationUserIdTemplate
+	}
+
+	for k, v := range config.passwordConfig.toResponseData() {
+		respData[k] = v
+	}
+
+	if !config.LastRotated.IsZero() {
+		respData["last_rotated"] = config.LastRotated
+	}
+
+	if !config.NextRotation.IsZero() {
+		respData["next_rotation"] = config.NextRotation
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"username": config.Username,
-			"url":      config.URL,
-			"insecure": config.Insecure,
-			"timeout":  config.Timeout,
-		},
+		Data: respData,
 	}, nil
 }
 
 // pathConfigAdminWrite write (and force updates) the configuration for the backend
 func (b *backend) pathConfigAdminWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// a rotation in progress would persist its configuration over this one
+	b.rotationMutex.Lock()
+	defer b.rotationMutex.Unlock()
 	b.configMutex.Lock()
 	defer b.configMutex.Unlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	connection := connectionName(data)
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +413,56 @@ func (b *backend) pathConfigAdminWrite(ctx context.Context, req *logical.Request
 		config.Timeout = data.Get("timeout").(int)
 	}
 
+	if caCert, ok := data.GetOk("ca_cert"); ok {
+		config.CACert = caCert.(string)
+	}
+
+	if clientCert, ok := data.GetOk("client_cert"); ok {
+		config.ClientCert = clientCert.(string)
+	}
+
+	if clientKey, ok := data.GetOk("client_key"); ok {
+		config.ClientKey = clientKey.(string)
+	}
+
+	if tlsServerName, ok := data.GetOk("tls_server_name"); ok {
+		config.TLSServerName = tlsServerName.(string)
+	}
+
+	if tlsMinVersion, ok := data.GetOk("tls_min_version"); ok {
+		config.TLSMinVersion = tlsMinVersion.(string)
+	}
+
+	if proxyURL, ok := data.GetOk("proxy_url"); ok {
+		config.ProxyURL = proxyURL.(string)
+	}
+
+	if noProxy, ok := data.GetOk("no_proxy"); ok {
+		config.NoProxy = noProxy.(string)
+	}
+
+	if headers, ok := data.GetOk("headers"); ok {
+		config.Headers = headers.(map[string]string)
+	}
+
+	if rotationPeriod, ok := data.GetOk("rotation_period"); ok {
+		config.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+	}
+
+	if rotationSchedule, ok := data.GetOk("rotation_schedule"); ok {
+		config.RotationSchedule = rotationSchedule.(string)
+	}
+
+	if rotationMode, ok := data.GetOk("rotation_mode"); ok {
+		config.RotationMode = rotationMode.(string)
+	}
+
+	if rotationUserIdTemplate, ok := data.GetOk("rotation_user_id_template"); ok {
+		config.RotationUserIdTemplate = rotationUserIdTemplate.(string)
+	}
+
+	config.passwordConfig.update(data)
+
 	// Verify
 	if config.Username == "" {
 		return logical.ErrorResponse(`missing "username" in admin configuration`), nil
@@ -185,7 +476,46 @@ func (b *backend) pathConfigAdminWrite(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse(`missing "password" in admin configuration`), nil
 	}
 
-	entry, err := logical.StorageEntryJSON(configAdminPath, config)
+	if _, err := newHTTPClient(config); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if config.RotationPeriod > 0 && config.RotationSchedule != "" {
+		return logical.ErrorResponse(`"rotation_period" and "rotation_schedule" are mutually exclusive`), nil
+	}
+
+	if config.RotationPeriod > 0 && config.RotationPeriod < minRotationPeriod {
+		return logical.ErrorResponse(`"rotation_period" must be at least %s`, minRotationPeriod), nil
+	}
+
+	if err := config.scheduleNextRotation(); err != nil {
+		return logical.ErrorResponse(`"rotation_schedule" is not a valid cron expression`), nil
+	}
+
+	switch config.RotationMode {
+	case "", rotationModePassword, rotationModeCloneUser:
+	default:
+		return logical.ErrorResponse(`"rotation_mode" must be one of "%s" or "%s"`, rotationModePassword, rotationModeCloneUser), nil
+	}
+
+	if config.RotationUserIdTemplate != "" {
+		if _, err := template.NewTemplate(template.Template(config.RotationUserIdTemplate)); err != nil {
+			return logical.ErrorResponse(`unable to initialize "rotation_user_id_template"`), nil
+		}
+	}
+
+	if err := b.validatePasswordConfig(ctx, config.passwordConfig); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var warnings []string
+	if data.Get("verify_connection").(bool) {
+		if warnings, err = verifyConnection(config); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(adminConfigPath(connection), config)
 	if err != nil {
 		return nil, err
 	}
@@ -195,35 +525,59 @@ func (b *backend) pathConfigAdminWrite(ctx context.Context, req *logical.Request
 	}
 
 	// reset the client so the next invocation will pick up the new configuration
-	b.client = nil
+	delete(b.clients, connection)
+
+	if len(warnings) > 0 {
+		resp := &logical.Response{}
+		for _, warning := range warnings {
+			resp.AddWarning(warning)
+		}
+		return resp, nil
+	}
 
 	return nil, nil
 }
 
 // pathConfigAdminDelete removes the configuration for the backend
 func (b *backend) pathConfigAdminDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// a rotation in progress would persist its configuration over this one
+	b.rotationMutex.Lock()
+	defer b.rotationMutex.Unlock()
 	b.configMutex.Lock()
 	defer b.configMutex.Unlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	connection := connectionName(data)
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
+		return adminConfigNotFound(connection), nil
+	}
+
+	if connection != "" {
+		// the leases and users of its roles could not be managed anymore
+		reference, err := connectionReference(ctx, req.Storage, connection)
+		if err != nil {
+			return nil, err
+		}
+		if reference != "" {
+			return logical.ErrorResponse(`connection "%s" is used by %s`, connection, reference), nil
+		}
 	}
 
-	err = req.Storage.Delete(ctx, configAdminPath)
+	err = req.Storage.Delete(ctx, adminConfigPath(connection))
 	if err == nil {
-		b.client = nil
+		delete(b.clients, connection)
 	}
 
 	return nil, err
 }
 
-// fetchAdminConfig fetches admin configuration for the backend
-func (b *backend) fetchAdminConfig(ctx context.Context, s logical.Storage) (*adminConfig, error) {
-	entry, err := s.Get(ctx, configAdminPath)
+// fetchAdminConfig fetches the admin configuration of the connection,
+// the one of `config/admin` for the default (empty) connection
+func (b *backend) fetchAdminConfig(ctx context.Context, s logical.Storage, connection string) (*adminConfig, error) {
+	entry, err := s.Get(ctx, adminConfigPath(connection))
 	if err != nil {
 		return nil, err
 	}
@@ -258,5 +612,34 @@ the TLS connection verification with Nexus Repository
 
 An optional "timeout" parameter is the maximum time (in seconds)
 to wait before the request to the API is timed out.
+
+The optional "ca_cert" parameter adds a PEM encoded CA certificate to
+verify the Nexus Repository server, and "client_cert" with "client_key"
+set the client certificate presented for mTLS. "tls_server_name" and
+"tls_min_version" tune the verification and the TLS version.
+
+The optional "proxy_url" (with "no_proxy") parameter sets the proxy to
+reach Nexus Repository through, and "headers" adds headers to every
+request (e.g. a WAF bypass token).
+
+The configuration is verified against Nexus Repository before it is stored:
+the server must be reachable, the credential must authenticate and the user
+must hold the "nx-users-create", "nx-users-delete" and "nx-userschangepw"
+privileges (or "nx-users-all"). The privileges which cannot be read (e.g.
+roles of an external realm) are returned as a warning instead of rejecting
+the configuration. Set "verify_connection" to false to skip it.
+
+An optional "rotation_period" (or "rotation_schedule" as a cron expression)
+parameter will make the backend rotate the admin's password automatically.
+
+An optional "rotation_mode" parameter set to "clone_user" will make the
+rotation replace the admin user with a new one (ID generated from
+"rotation_user_id_template") holding the same roles, instead of
+changing the admin's password in place.
+
+The optional "password_policy" parameter names a Vault password policy
+used to generate the admin's new password on rotation. Without it,
+"password_length", "password_digits", "password_symbols" and
+"password_symbol_charset" control the generated password.
 `
 )
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
@@ -30,6 +31,7 @@ func Test_ConfigAdmin(t *testing.T) {
 	t.Run("ConfigAdmin_Update", testConfigAdmin_Update)
 	t.Run("ConfigAdmin_Update_Fail", testConfigAdmin_Update_Fail)
 	t.Run("ConfigAdmin_ReadDelete_Empty", testConfigAdmin_ReadDelete_Empty)
+	t.Run("ConfigAdmin_AutoRotation", testConfigAdmin_AutoRotation)
 }
 
 func testConfigAdmin_SimpleCRUD(t *testing.T) {
@@ -37,11 +39,12 @@ func testConfigAdmin_SimpleCRUD(t *testing.T) {
 
 	// Create base admin config
 	initData := testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      testConfigAdminURL,
-		"insecure": testConfigAdminInsecure,
-		"timeout":  testConfigAdminTimeout,
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"insecure":          testConfigAdminInsecure,
+		"timeout":           testConfigAdminTimeout,
 	}
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, initData)
 
@@ -61,11 +64,12 @@ func testConfigAdmin_SimpleCRUD(t *testing.T) {
 
 	// Update admin config
 	updateData := testData{
-		"username": testConfigAdminUsernameUpdate,
-		"password": testConfigAdminPasswordUpdate,
-		"url":      testConfigAdminURLUpdate,
-		"insecure": testConfigAdminInsecureUpdate,
-		"timeout":  testConfigAdminTimeoutUpdate,
+		"username":          testConfigAdminUsernameUpdate,
+		"password":          testConfigAdminPasswordUpdate,
+		"url":               testConfigAdminURLUpdate,
+		"verify_connection": false,
+		"insecure":          testConfigAdminInsecureUpdate,
+		"timeout":           testConfigAdminTimeoutUpdate,
 	}
 	resp, err = doAction(actionCreate, configAdminPath, b, reqStorage, updateData)
 
@@ -94,9 +98,10 @@ func testConfigAdmin_Create(t *testing.T) {
 
 	// Create admin config with minimum required fields
 	data := testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      testConfigAdminURL,
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
 	}
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, data)
 
@@ -132,8 +137,9 @@ func testConfigAdmin_Create_MissingRequireFields(t *testing.T) {
 		},
 		{
 			data: &testData{
-				"username": testConfigAdminUsername,
-				"url":      testConfigAdminURL,
+				"username":          testConfigAdminUsername,
+				"url":               testConfigAdminURL,
+				"verify_connection": false,
 			},
 			missingField: "password",
 		},
@@ -191,8 +197,9 @@ func testConfigAdmin_Update(t *testing.T) {
 		// Update "url" (and "password" must be set also)
 		{
 			updateData: &testData{
-				"url":      testConfigAdminURLUpdate,
-				"password": testConfigAdminPasswordUpdate,
+				"url":               testConfigAdminURLUpdate,
+				"verify_connection": false,
+				"password":          testConfigAdminPasswordUpdate,
 			},
 			expected: &testData{
 				"username": testConfigAdminUsername,
@@ -353,9 +360,10 @@ func testConfigAdmin_Update(t *testing.T) {
 		b, reqStorage := getTestBackend(t)
 
 		initData := testData{
-			"username": testConfigAdminUsername,
-			"password": testConfigAdminPassword,
-			"url":      testConfigAdminURL,
+			"username":          testConfigAdminUsername,
+			"password":          testConfigAdminPassword,
+			"url":               testConfigAdminURL,
+			"verify_connection": false,
 		}
 		resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, initData)
 
@@ -363,6 +371,7 @@ func testConfigAdmin_Update(t *testing.T) {
 		assert.Nil(t, resp)
 
 		// Update
+		(*tc.updateData)["verify_connection"] = false
 		resp, err = doAction(actionUpdate, configAdminPath, b, reqStorage, *tc.updateData)
 
 		require.NoError(t, err)
@@ -393,7 +402,8 @@ func testConfigAdmin_Update_Fail(t *testing.T) {
 		// Update only "url" (keep "password" unchange)
 		{
 			updateData: &testData{
-				"url": testConfigAdminURLUpdate,
+				"url":               testConfigAdminURLUpdate,
+				"verify_connection": false,
 			},
 			expectedErrorContains: `missing "password" in admin configuration`,
 		},
@@ -423,9 +433,10 @@ func testConfigAdmin_Update_Fail(t *testing.T) {
 		b, reqStorage := getTestBackend(t)
 
 		initData := testData{
-			"username": testConfigAdminUsername,
-			"password": testConfigAdminPassword,
-			"url":      testConfigAdminURL,
+			"username":          testConfigAdminUsername,
+			"password":          testConfigAdminPassword,
+			"url":               testConfigAdminURL,
+			"verify_connection": false,
 		}
 		resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, initData)
 
@@ -457,3 +468,90 @@ func testConfigAdmin_ReadDelete_Empty(t *testing.T) {
 		assert.Equal(t, expectedError, resp.Error().Error())
 	}
 }
+
+func testConfigAdmin_AutoRotation(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// Rotation period
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"rotation_period":   "720h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, int64(720*60*60), resp.Data["rotation_period"])
+	assert.NotContains(t, resp.Data, "rotation_schedule")
+	assert.NotContains(t, resp.Data, "last_rotated")
+	assert.WithinDuration(t, time.Now().Add(720*time.Hour), resp.Data["next_rotation"].(time.Time), time.Minute)
+
+	// Switch to rotation schedule
+	resp, err = doAction(actionUpdate, configAdminPath, b, reqStorage, testData{
+		"rotation_period":   0,
+		"rotation_schedule": "0 0 1 * *",
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.NotContains(t, resp.Data, "rotation_period")
+	assert.Equal(t, "0 0 1 * *", resp.Data["rotation_schedule"])
+	assert.Equal(t, 1, resp.Data["next_rotation"].(time.Time).Day())
+
+	// Invalid values
+	testCases := []struct {
+		data          *testData // test input data
+		expectedError string    // expected error message
+	}{
+		{
+			data: &testData{
+				"rotation_period": "1h",
+			},
+			expectedError: `"rotation_period" and "rotation_schedule" are mutually exclusive`,
+		},
+		{
+			data: &testData{
+				"rotation_period":   "10s",
+				"rotation_schedule": "",
+			},
+			expectedError: `"rotation_period" must be at least 1m0s`,
+		},
+		{
+			data: &testData{
+				"rotation_schedule": "every day",
+			},
+			expectedError: `"rotation_schedule" is not a valid cron expression`,
+		},
+		{
+			data: &testData{
+				"rotation_mode": "recreate",
+			},
+			expectedError: `"rotation_mode" must be one of "password" or "clone_user"`,
+		},
+		{
+			data: &testData{
+				"rotation_mode":             rotationModeCloneUser,
+				"rotation_user_id_template": "{{ abc",
+			},
+			expectedError: `unable to initialize "rotation_user_id_template"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		resp, err := doAction(actionUpdate, configAdminPath, b, reqStorage, *tc.data)
+
+		require.NoError(t, err)
+		assert.NotNil(t, resp)
+		assert.True(t, resp.IsError())
+		assert.Equal(t, tc.expectedError, resp.Error().Error())
+	}
+}
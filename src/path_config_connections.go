@@ -0,0 +1,258 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	configConnectionsPath = "config/connections/"
+	connectionHelp        = "Optional. Name of the connection (`config/connections/<name>`) to the Nexus Repository managing the users. Default to the one of `config/admin`."
+)
+
+// connectionName returns the name of the connection of a configuration path,
+// empty for `config/admin`
+func connectionName(data *framework.FieldData) string {
+	if _, ok := data.Schema["name"]; !ok {
+		return ""
+	}
+
+	return data.Get("name").(string)
+}
+
+// adminConfigPath returns the storage path of the admin configuration of the connection
+func adminConfigPath(connection string) string {
+	if connection == "" {
+		return configAdminPath
+	}
+
+	return configConnectionsPath + connection
+}
+
+// adminConfigNotFound returns the error response of a connection without admin configuration
+func adminConfigNotFound(connection string) *logical.Response {
+	if connection == "" {
+		return logical.ErrorResponse("admin configuration not found")
+	}
+
+	return logical.ErrorResponse(`connection "%s" not found`, connection)
+}
+
+// listConnections returns the names of all connections, the default (empty) one included
+func listConnections(ctx context.Context, s logical.Storage) ([]string, error) {
+	names, err := s.List(ctx, configConnectionsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{""}, names...), nil
+}
+
+// roleUsingConnection returns the name of a role, or static role, using the connection, if any
+func roleUsingConnection(ctx context.Context, s logical.Storage, connection string) (string, error) {
+	roleNames, err := s.List(ctx, rolesPath)
+	if err != nil {
+		return "", err
+	}
+	for _, roleName := range roleNames {
+		role, err := getRole(ctx, s, roleName)
+		if err != nil {
+			return "", err
+		}
+		if role != nil && role.Connection == connection {
+			return roleName, nil
+		}
+	}
+
+	staticRoleNames, err := s.List(ctx, staticRolesPath)
+	if err != nil {
+		return "", err
+	}
+	for _, roleName := range staticRoleNames {
+		role, err := getStaticRole(ctx, s, roleName)
+		if err != nil {
+			return "", err
+		}
+		if role != nil && role.Connection == connection {
+			return roleName, nil
+		}
+	}
+
+	return "", nil
+}
+
+// connectionReference describes what still references the connection, if anything: a role,
+// the lease of an issued user, a disabled user to purge, a retired admin user, or a WAL entry to roll back
+func connectionReference(ctx context.Context, s logical.Storage, connection string) (string, error) {
+	roleName, err := roleUsingConnection(ctx, s, connection)
+	if err != nil {
+		return "", err
+	}
+	if roleName != "" {
+		return fmt.Sprintf(`role "%s"`, roleName), nil
+	}
+
+	roleNames, err := s.List(ctx, issuedUsersPath)
+	if err != nil {
+		return "", err
+	}
+	for _, roleName := range roleNames {
+		roleName = strings.TrimSuffix(roleName, "/")
+		userIDs, err := s.List(ctx, issuedUsersPath+roleName+"/")
+		if err != nil {
+			return "", err
+		}
+		for _, userID := range userIDs {
+			issued, err := getIssuedUser(ctx, s, roleName, userID)
+			if err != nil {
+				return "", err
+			}
+			if issued != nil && issued.Connection == connection {
+				return fmt.Sprintf(`the lease of user "%s"`, userID), nil
+			}
+		}
+	}
+
+	userIDs, err := s.List(ctx, disabledUsersPath)
+	if err != nil {
+		return "", err
+	}
+	for _, userID := range userIDs {
+		disabled, err := getDisabledUser(ctx, s, userID)
+		if err != nil {
+			return "", err
+		}
+		// the users disabled for good (revocation_mode "disable") are not purged
+		if disabled != nil && disabled.Connection == connection && !disabled.PurgeAt.IsZero() {
+			return fmt.Sprintf(`disabled user "%s"`, userID), nil
+		}
+	}
+
+	userIDs, err = s.List(ctx, retiredAdminsPath)
+	if err != nil {
+		return "", err
+	}
+	for _, userID := range userIDs {
+		retired, err := getRetiredAdminUser(ctx, s, userID)
+		if err != nil {
+			return "", err
+		}
+		if retired != nil && retired.Connection == connection {
+			return fmt.Sprintf(`retired admin user "%s"`, userID), nil
+		}
+	}
+
+	walIDs, err := framework.ListWAL(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	for _, walID := range walIDs {
+		wal, err := framework.GetWAL(ctx, s, walID)
+		if err != nil {
+			return "", err
+		}
+		if wal == nil {
+			continue
+		}
+
+		var entry struct {
+			Connection string `mapstructure:"connection"`
+		}
+		if err := mapstructure.WeakDecode(wal.Data, &entry); err != nil {
+			return "", err
+		}
+		if entry.Connection == connection {
+			return fmt.Sprintf(`the %s WAL entry "%s"`, wal.Kind, walID), nil
+		}
+	}
+
+	return "", nil
+}
+
+// pathConfigConnections extends the Vault API with a `config/connections/<name>`
+// endpoint for the backend, each connection has its own admin configuration.
+func pathConfigConnections(b *backend) *framework.Path {
+	fields := adminConfigFields()
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeNameString,
+		Description: "Name of the connection.",
+		Required:    true,
+	}
+
+	return &framework.Path{
+		Pattern: configConnectionsPath + framework.GenericNameRegex("name"),
+		Fields:  fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigAdminRead,
+				Summary:  "Examine the admin configuration of a Nexus Repository connection.",
+			},
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathConfigAdminWrite,
+				Summary:  "Create the admin configuration of a Nexus Repository connection.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigAdminWrite,
+				Summary:  "Update (overwrite) the admin configuration of a Nexus Repository connection.",
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathConfigAdminDelete,
+				Summary:  "Delete the admin configuration of a Nexus Repository connection.",
+			},
+		},
+		ExistenceCheck:  b.pathExistenceCheck,
+		HelpSynopsis:    pathConfigConnectionsHelpSynopsis,
+		HelpDescription: pathConfigConnectionsHelpDescription,
+	}
+}
+
+// pathConfigConnectionsList extends the Vault API with a `config/connections`
+// endpoint listing the connections.
+func pathConfigConnectionsList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: configConnectionsPath + "?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathConfigConnectionsList,
+				Summary:  "List the Nexus Repository connections.",
+			},
+		},
+		HelpSynopsis:    pathConfigConnectionsListHelpSynopsis,
+		HelpDescription: pathConfigConnectionsListHelpDescription,
+	}
+}
+
+// pathConfigConnectionsList makes a request to Vault storage to retrieve the list of connections
+func (b *backend) pathConfigConnectionsList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	entries, err := req.Storage.List(ctx, configConnectionsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+const (
+	pathConfigConnectionsHelpSynopsis = `Configure a named Nexus Repository connection.`
+
+	pathConfigConnectionsHelpDescription = `
+A connection is the admin configuration of another Nexus Repository, with
+the same parameters as "config/admin". Roles and static roles manage their
+users on the connection set in their "connection" parameter, or on the one
+of "config/admin" if not set.
+
+A connection used by a role, by the lease of an issued user, by a disabled
+user to purge or by a pending rollback cannot be deleted.
+`
+
+	pathConfigConnectionsListHelpSynopsis    = `List the named Nexus Repository connections.`
+	pathConfigConnectionsListHelpDescription = `List the connections configured with "config/connections/<name>".`
+)
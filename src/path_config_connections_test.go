@@ -0,0 +1,255 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	testConnectionName = "eu"
+	testConnectionPath = configConnectionsPath + testConnectionName
+)
+
+func Test_ConfigConnections(t *testing.T) {
+	t.Run("ConfigConnections_CRUD", testConfigConnections_CRUD)
+	t.Run("ConfigConnections_Creds_WithMockApi", testConfigConnections_Creds_WithMockApi)
+	t.Run("ConfigConnections_Rotate_WithMockApi", testConfigConnections_Rotate_WithMockApi)
+	t.Run("ConfigConnections_Delete_InUse", testConfigConnections_Delete_InUse)
+	t.Run("ConfigConnections_Fail", testConfigConnections_Fail)
+}
+
+func testConfigConnections_CRUD(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := doAction(actionCreate, testConnectionPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, testConnectionPath, b, reqStorage, testData{
+		"url":               testConfigAdminURLUpdate,
+		"password":          testConfigAdminPasswordUpdate,
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testConnectionPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testConfigAdminUsername, resp.Data["username"])
+	assert.Equal(t, testConfigAdminURLUpdate, resp.Data["url"])
+	assert.NotContains(t, resp.Data, "password")
+
+	resp, err = doAction(actionList, configConnectionsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{testConnectionName}, resp.Data["keys"])
+
+	// The connection is independent of config/admin
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, "admin configuration not found", resp.Error().Error())
+
+	resp, err = doAction(actionDelete, testConnectionPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testConnectionPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `connection "eu" not found`, resp.Error().Error())
+}
+
+func testConfigConnections_Creds_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// No request reaches the Nexus Repository of config/admin
+	defaultSrv := httpmock.New()(t)
+	connectionSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               defaultSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, testConnectionPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               connectionSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+		"connection":  testConnectionName,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, rolesPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testConnectionName, resp.Data["connection"])
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testConnectionName, resp.Secret.InternalData["connection"])
+
+	// A connection used by a role cannot be deleted
+	deleteResp, err := doAction(actionDelete, testConnectionPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, deleteResp.IsError())
+	assert.Equal(t, `connection "eu" is used by role "test-role"`, deleteResp.Error().Error())
+
+	// The user is revoked on the connection it was issued on
+	connectionSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"]))
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The status of the connection
+	connectionSrv.ExpectGet(statusURI)
+	connectionSrv.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+		ReturnJSON([]string{})
+	resp, err = doAction(actionRead, statusPath+"/"+testConnectionName, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, true, resp.Data["authenticated"])
+	assert.Contains(t, resp.Data, "last_api_call")
+}
+
+func testConfigConnections_Delete_InUse(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	ctx := context.Background()
+
+	resp, err := doAction(actionCreate, testConnectionPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	assertInUse := func(expectedError string) {
+		t.Helper()
+		resp, err := doAction(actionDelete, testConnectionPath, b, reqStorage, nil)
+		require.NoError(t, err)
+		assert.True(t, resp.IsError())
+		assert.Equal(t, expectedError, resp.Error().Error())
+	}
+
+	// The lease of a user issued on the connection, its role being deleted
+	issued := &issuedUser{UserID: "v-issued", RoleName: testRoleName, Connection: testConnectionName}
+	require.NoError(t, setIssuedUser(ctx, reqStorage, issued))
+	assertInUse(`connection "eu" is used by the lease of user "v-issued"`)
+	require.NoError(t, deleteIssuedUser(ctx, reqStorage, testRoleName, issued.UserID))
+
+	// A disabled user waiting to be purged
+	require.NoError(t, setDisabledUser(ctx, reqStorage, &disabledUser{UserID: "v-disabled", Connection: testConnectionName, PurgeAt: time.Now().Add(time.Hour)}))
+	assertInUse(`connection "eu" is used by disabled user "v-disabled"`)
+	require.NoError(t, reqStorage.Delete(ctx, disabledUsersPath+"v-disabled"))
+
+	// A user creation to roll back
+	walID, err := framework.PutWAL(ctx, reqStorage, userCreationWALKind, &userCreationWAL{UserID: "v-created", RoleName: testRoleName, Connection: testConnectionName})
+	require.NoError(t, err)
+	assertInUse(fmt.Sprintf(`connection "eu" is used by the userCreation WAL entry "%s"`, walID))
+	require.NoError(t, framework.DeleteWAL(ctx, reqStorage, walID))
+
+	// Neither the entries of other connections nor the users disabled for good block the deletion
+	require.NoError(t, setDisabledUser(ctx, reqStorage, &disabledUser{UserID: "v-disabled", PurgeAt: time.Now()}))
+	require.NoError(t, setDisabledUser(ctx, reqStorage, &disabledUser{UserID: "v-kept", Connection: testConnectionName}))
+	resp, err = doAction(actionDelete, testConnectionPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testConfigConnections_Rotate_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername))
+		// Verify the new password
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusForbidden)
+	})(t)
+
+	resp, err := doAction(actionCreate, testConnectionPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, testConnectionPath+"/rotate", b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	config, err := b.fetchAdminConfig(context.Background(), reqStorage, testConnectionName)
+	require.NoError(t, err)
+	assert.NotEqual(t, testConfigAdminPassword, config.Password)
+	assert.False(t, config.LastRotated.IsZero())
+}
+
+func testConfigConnections_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Unknown connection
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+		"connection":  "us",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `connection "us" not found`, resp.Error().Error())
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id":    testStaticRoleUserID,
+		"connection": "us",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `connection "us" not found`, resp.Error().Error())
+
+	resp, err = doAction(actionUpdate, configConnectionsPath+"us/rotate", b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `connection "us" not found`, resp.Error().Error())
+
+	resp, err = doAction(actionRead, statusPath+"/us", b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `connection "us" not found`, resp.Error().Error())
+}
@@ -2,32 +2,45 @@ package nxr
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/template"
 	"github.com/hashicorp/vault/sdk/logical"
-	gopw "github.com/sethvargo/go-password/password"
+	"github.com/mitchellh/mapstructure"
 )
 
 const (
-	configRotatePath = "config/rotate"
+	configRotatePath              = "config/rotate"
+	rotationModePassword          = "password"
+	rotationModeCloneUser         = "clone_user"
+	defaultRotationUserIdTemplate = `{{ printf "vault-admin-%s-%s" (unix_time) (random 8) | lowercase }}`
+	retiredAdminsPath             = "retired-admins/"
+	retiredAdminGracePeriod       = 10 * time.Minute
 )
 
+// retiredAdminUser records an admin user replaced in `clone_user` rotation mode, it is deleted
+// after a grace period as other Vault nodes may still use it until their client is reset
+type retiredAdminUser struct {
+	UserID     string    `json:"user_id"`
+	Connection string    `json:"connection,omitempty"`
+	DeleteAt   time.Time `json:"delete_at"`
+}
+
+// adminUserIdMetadata defines the metadata that a rotation_user_id_template can use
+// to generate the ID of the new admin user
+type adminUserIdMetadata struct {
+	Username string
+}
+
 // pathConfigRotate replaces the configurated admin's password
-// with a random one.
+// with a random one, or replaces the admin user with a new one.
 func pathConfigRotate(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: configRotatePath,
-		// TODO: rotate by creating a new user with same privileges and revoking the current one
-		// Fields: map[string]*framework.FieldSchema{
-		// 	"username": {
-		// 		Type:        framework.TypeLowerCaseString,
-		// 		Description: "Optional. Overwrite the username to access Nexus Repository API",
-		// 		DisplayAttrs: &framework.DisplayAttributes{
-		// 			Name:      "Username",
-		// 			Sensitive: false,
-		// 		},
-		// 	},
-		// },
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
 				Callback: b.pathConfigRotateWrite,
@@ -39,47 +52,328 @@ func pathConfigRotate(b *backend) *framework.Path {
 	}
 }
 
+// pathConfigConnectionRotate replaces the admin credential of a named connection,
+// as `config/rotate` does for the one of `config/admin`.
+func pathConfigConnectionRotate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: configConnectionsPath + framework.GenericNameRegex("name") + "/rotate",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeNameString,
+				Description: "Name of the connection.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigRotateWrite,
+				Summary:  "Rotate the admin credential of a Nexus Repository connection",
+			},
+		},
+		HelpSynopsis:    pathConfigRotateHelpSynopsis,
+		HelpDescription: pathConfigRotateHelpDescription,
+	}
+}
+
 func (b *backend) pathConfigRotateWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	connection := connectionName(data)
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
+		return adminConfigNotFound(connection), nil
 	}
 
-	// TODO: allow user configs password complexity
-	newPw, err := gopw.Generate(64, 10, 0, false, true)
-	if err != nil {
+	if err := b.rotateAdminCredential(ctx, req.Storage, connection, config); err != nil {
 		return nil, err
 	}
 
-	nxrClient, err := b.getClient(ctx, req.Storage)
+	return nil, nil
+}
+
+// rotateAdminCredential replaces the admin's credential (according to the rotation mode),
+// persists it and schedules the next automatic rotation (if configured). The rotation is
+// skipped if another one happened since the caller read the configuration.
+func (b *backend) rotateAdminCredential(ctx context.Context, s logical.Storage, connection string, read *adminConfig) error {
+	b.rotationMutex.Lock()
+	defer b.rotationMutex.Unlock()
+
+	config, err := b.fetchAdminConfig(ctx, s, connection)
+	if err != nil {
+		return err
+	}
+	if config == nil || !config.LastRotated.Equal(read.LastRotated) || !config.NextRotation.Equal(read.NextRotation) {
+		b.Logger().Debug("admin credential rotated or changed concurrently, skipping rotation", "connection", connection)
+		return nil
+	}
+
+	newPw, err := b.generatePassword(ctx, config.passwordConfig)
+	if err != nil {
+		return err
+	}
+
+	nxrClient, err := b.getClient(ctx, s, connection)
+	if err != nil {
+		return err
+	}
+
+	oldUsername := config.Username
+	cloneUser := config.RotationMode == rotationModeCloneUser
+
+	var walID string
+	if cloneUser {
+		if err = cloneAdminUser(nxrClient, config, newPw); err != nil {
+			return err
+		}
+	} else {
+		walID, err = b.changeAdminPassword(ctx, s, nxrClient, connection, config, newPw)
+		if err != nil {
+			return err
+		}
+	}
+
+	config.LastRotated = time.Now()
+	if err := config.scheduleNextRotation(); err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(adminConfigPath(connection), config)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Put(ctx, entry); err != nil {
+		if cloneUser {
+			// the new user is unknown to Vault, the current one is still in use
+			_ = nxrClient.deleteUser(config.Username)
+		} else {
+			b.rollbackAdminPasswordNow(ctx, s, walID)
+		}
+		return err
+	}
+
+	if walID != "" {
+		if err := framework.DeleteWAL(ctx, s, walID); err != nil {
+			// the rollback will find the new password persisted and do nothing
+			b.Logger().Warn("could not delete WAL entry of admin password rotation", "wal_id", walID, "error", err)
+		}
+	}
+
+	// reset the client so the next invocation will pick up the new configuration
+	b.reset(connection)
+
+	if cloneUser {
+		err := setRetiredAdminUser(ctx, s, &retiredAdminUser{
+			UserID:     oldUsername,
+			Connection: connection,
+			DeleteAt:   time.Now().Add(retiredAdminGracePeriod),
+		})
+		if err != nil {
+			// the new credential is already in use, only log the leftover user
+			b.Logger().Error("could not schedule the deletion of the previous admin user", "user_id", oldUsername, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteRetiredAdminUsers deletes the previous admin users whose grace period has elapsed
+func (b *backend) deleteRetiredAdminUsers(ctx context.Context, s logical.Storage) error {
+	userIDs, err := s.List(ctx, retiredAdminsPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		retired, err := getRetiredAdminUser(ctx, s, userID)
+		if err != nil {
+			return err
+		}
+		if retired == nil || now.Before(retired.DeleteAt) {
+			continue
+		}
+
+		client, err := b.getClient(ctx, s, retired.Connection)
+		if err == nil {
+			err = client.deleteUser(retired.UserID)
+		}
+		if err != nil && !isNotFound(err) {
+			// keep going, the user will be retried on the next tick
+			b.Logger().Error("could not delete the previous admin user", "connection", retired.Connection, "user_id", userID, "error", err)
+			continue
+		}
+
+		if err := s.Delete(ctx, retiredAdminsPath+userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getRetiredAdminUser gets the previous admin user from the Vault storage API
+func getRetiredAdminUser(ctx context.Context, s logical.Storage, userID string) (*retiredAdminUser, error) {
+	entry, err := s.Get(ctx, retiredAdminsPath+userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = nxrClient.changeUserPassword(config.Username, newPw); err != nil {
+	if entry == nil {
+		return nil, nil
+	}
+
+	var retired retiredAdminUser
+	if err := entry.DecodeJSON(&retired); err != nil {
 		return nil, err
 	}
+	return &retired, nil
+}
+
+// setRetiredAdminUser adds the previous admin user to the Vault storage API
+func setRetiredAdminUser(ctx context.Context, s logical.Storage, retired *retiredAdminUser) error {
+	entry, err := logical.StorageEntryJSON(retiredAdminsPath+retired.UserID, retired)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// changeAdminPassword changes and verifies the admin's password, then updates the configuration
+// with it. A WAL entry recording the previous password is kept until the new one is persisted,
+// it is returned so the caller can clear it.
+func (b *backend) changeAdminPassword(ctx context.Context, s logical.Storage, c *nxrClient, connection string, config *adminConfig, newPw string) (string, error) {
+	walID, err := framework.PutWAL(ctx, s, adminPasswordWALKind, &adminPasswordWAL{
+		Connection:  connection,
+		Username:    config.Username,
+		OldPassword: config.Password,
+		NewPassword: newPw,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// On failure the password may have been changed anyway (e.g. timed out request),
+	// the WAL entry is left to the periodic rollback
+	if err := c.changeUserPassword(config.Username, newPw); err != nil {
+		return "", err
+	}
 
-	// TODO: check if new password is usable (assume to yes)
+	newConfig := *config
+	newConfig.Password = newPw
+
+	if err := verifyCredential(&newConfig); err != nil {
+		b.rollbackAdminPasswordNow(ctx, s, walID)
+		return "", err
+	}
 
 	config.Password = newPw
 
-	entry, err := logical.StorageEntryJSON(configAdminPath, config)
+	return walID, nil
+}
+
+// rollbackAdminPasswordNow restores the previous admin's password without waiting for the
+// periodic rollback, the WAL entry is kept for a later attempt if the restoration fails.
+// The caller must hold rotationMutex.
+func (b *backend) rollbackAdminPasswordNow(ctx context.Context, s logical.Storage, walID string) {
+	walEntry, err := framework.GetWAL(ctx, s, walID)
+	if err == nil && walEntry != nil {
+		var entry adminPasswordWAL
+		err = mapstructure.Decode(walEntry.Data, &entry)
+		if err == nil {
+			err = b.rollbackAdminPassword(ctx, s, &entry)
+		}
+	}
+	if err == nil {
+		err = framework.DeleteWAL(ctx, s, walID)
+	}
 	if err != nil {
-		return nil, err
+		b.Logger().Error("could not roll back admin password rotation, will retry later", "wal_id", walID, "error", err)
 	}
+}
 
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, err
+// cloneAdminUser creates a new user with the same roles as the current admin user,
+// verifies that the new credential is usable then updates the configuration with it
+func cloneAdminUser(c *nxrClient, config *adminConfig, newPw string) error {
+	current, err := c.getUser(config.Username)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("could not find admin user '%s' on Nexus Repository", config.Username)
 	}
 
-	// reset the client so the next invocation will pick up the new configuration
-	b.reset()
+	userIdTemplate := config.RotationUserIdTemplate
+	if userIdTemplate == "" {
+		userIdTemplate = defaultRotationUserIdTemplate
+	}
 
-	return nil, nil
+	up, err := template.NewTemplate(template.Template(userIdTemplate))
+	if err != nil {
+		return err
+	}
+	newUserId, err := up.Generate(adminUserIdMetadata{
+		Username: config.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.createUser(security.User{
+		UserID:       newUserId,
+		FirstName:    current.FirstName,
+		LastName:     current.LastName,
+		EmailAddress: current.EmailAddress,
+		Password:     newPw,
+		Roles:        current.Roles,
+		Status:       "active",
+	})
+	if err != nil {
+		return err
+	}
+
+	newConfig := *config
+	newConfig.Username = newUserId
+	newConfig.Password = newPw
+
+	if err := verifyCredential(&newConfig); err != nil {
+		_ = c.deleteUser(newUserId)
+		return err
+	}
+
+	config.Username = newUserId
+	config.Password = newPw
+
+	return nil
+}
+
+// rotateAdminCredentialIfDue rotates the admin's password of each connection when
+// its automatic rotation is configured and the due time has passed
+func (b *backend) rotateAdminCredentialIfDue(ctx context.Context, s logical.Storage) error {
+	connections, err := listConnections(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, connection := range connections {
+		config, err := b.fetchAdminConfig(ctx, s, connection)
+		if err != nil {
+			return err
+		}
+		if config == nil || !config.hasAutoRotation() || time.Now().Before(config.NextRotation) {
+			continue
+		}
+
+		// the other connections are still rotated
+		if err := b.rotateAdminCredential(ctx, s, connection, config); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("connection '%s': %w", connection, err))
+		}
+	}
+
+	return errs
 }
 
 const (
@@ -87,5 +381,18 @@ const (
 
 	pathConfigRotateHelpDescription = `
 This will rotate the "password" used to access Nexus Repository from this plugin.
+The new password is verified against Nexus Repository before being persisted,
+the previous password is restored if the rotation cannot be completed.
+
+When "rotation_mode" of the admin configuration is "clone_user", a new user
+with the same roles as the current admin user is created instead,
+its credential is verified and persisted, then the previous admin user is deleted
+after a grace period of 10 minutes, as other Vault nodes may still be using it.
+
+The rotation also happens automatically when "rotation_period"
+or "rotation_schedule" is set in the admin configuration.
+
+The admin credential of a named connection is rotated with
+"config/connections/<name>/rotate".
 `
 )
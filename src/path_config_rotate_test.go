@@ -1,11 +1,17 @@
 package nxr
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
 	"testing"
 	"time"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,6 +27,22 @@ func Test_ConfigRotate(t *testing.T) {
 	t.Run("ConfigRotate_Fail", testConfigRotate_Fail)
 	t.Run("ConfigRotate_WithMockApi", testConfigRotate_WithMockApi)
 	t.Run("ConfigRotate_WithMockApi_Fail", testConfigRotate_WithMockApi_Fail)
+	t.Run("ConfigRotate_Scheduled_WithMockApi", testConfigRotate_Scheduled_WithMockApi)
+	t.Run("ConfigRotate_CloneUser_WithMockApi", testConfigRotate_CloneUser_WithMockApi)
+	t.Run("ConfigRotate_CloneUser_WithMockApi_Fail", testConfigRotate_CloneUser_WithMockApi_Fail)
+	t.Run("ConfigRotate_Verify_WithMockApi_Fail", testConfigRotate_Verify_WithMockApi_Fail)
+	t.Run("ConfigRotate_WALRollback_WithMockApi", testConfigRotate_WALRollback_WithMockApi)
+}
+
+const (
+	userGetURI      = "/service/rest/v1/security/users?userId=%s"
+	userGetURIRegex = `^/service/rest/v1/security/users\?userId=vault-admin-`
+	userURIRegex    = `^/service/rest/v1/security/users/vault-admin-`
+)
+
+// returnRequestedUser mocks the user lookup API by returning the requested user
+func returnRequestedUser(r *http.Request) ([]byte, error) {
+	return json.Marshal([]security.User{{UserID: r.URL.Query().Get("userId")}})
 }
 
 func testConfigRotate_Fail(t *testing.T) {
@@ -54,12 +76,16 @@ func testConfigRotate_WithMockApi(t *testing.T) {
 	mockSrv := httpmock.New(func(s *httpmock.Server) {
 		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
 			ReturnCode(httpmock.StatusOK)
+		// Verify the new password
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusForbidden)
 	})(t)
 
 	data := &testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      mockSrv.URL(),
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
 	}
 
 	// Create base config
@@ -87,21 +113,21 @@ func testConfigRotate_WithMockApi_Fail(t *testing.T) {
 				s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
 					ReturnCode(httpmock.StatusGatewayTimeout)
 			})(t),
-			expectedError: fmt.Sprintf(`could not change password of user 'admin':  HTTP: %d`, httpmock.StatusGatewayTimeout),
+			expectedError: fmt.Sprintf(`could not change password of user 'admin': HTTP: %d`, httpmock.StatusGatewayTimeout),
 		},
 		{
 			mockSrv: httpmock.New(func(s *httpmock.Server) {
 				s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
 					ReturnCode(httpmock.StatusBadGateway)
 			})(t),
-			expectedError: fmt.Sprintf(`could not change password of user 'admin':  HTTP: %d`, httpmock.StatusBadGateway),
+			expectedError: fmt.Sprintf(`could not change password of user 'admin': HTTP: %d`, httpmock.StatusBadGateway),
 		},
 		{
 			mockSrv: httpmock.New(func(s *httpmock.Server) {
 				s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
 					ReturnCode(httpmock.StatusRequestTimeout)
 			})(t),
-			expectedError: fmt.Sprintf(`could not change password of user 'admin':  HTTP: %d`, httpmock.StatusRequestTimeout),
+			expectedError: fmt.Sprintf(`could not change password of user 'admin': HTTP: %d`, httpmock.StatusRequestTimeout),
 		},
 		{
 			mockSrv: httpmock.New(func(s *httpmock.Server) {
@@ -115,10 +141,11 @@ func testConfigRotate_WithMockApi_Fail(t *testing.T) {
 
 	for _, tc := range testCases {
 		_, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
-			"username": testConfigAdminUsername,
-			"password": testConfigAdminPassword,
-			"url":      tc.mockSrv.URL(),
-			"timeout":  "1s",
+			"username":          testConfigAdminUsername,
+			"password":          testConfigAdminPassword,
+			"url":               tc.mockSrv.URL(),
+			"verify_connection": false,
+			"timeout":           "1s",
 		})
 		require.NoError(t, err)
 
@@ -128,3 +155,242 @@ func testConfigRotate_WithMockApi_Fail(t *testing.T) {
 		assert.Nil(t, resp)
 	}
 }
+
+func testConfigRotate_Scheduled_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusOK)
+		// Verify the new password
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusForbidden)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+		"rotation_period":   "24h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	ctx := context.Background()
+
+	// Not due yet, nothing to rotate
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: reqStorage}))
+
+	config, err := b.fetchAdminConfig(ctx, reqStorage, "")
+	require.NoError(t, err)
+	assert.Equal(t, testConfigAdminPassword, config.Password)
+	assert.True(t, config.LastRotated.IsZero())
+
+	// Pretend the rotation is due
+	config.NextRotation = time.Now().Add(-time.Second)
+	entry, err := logical.StorageEntryJSON(configAdminPath, config)
+	require.NoError(t, err)
+	require.NoError(t, reqStorage.Put(ctx, entry))
+
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: reqStorage}))
+
+	config, err = b.fetchAdminConfig(ctx, reqStorage, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, testConfigAdminPassword, config.Password)
+	assert.WithinDuration(t, time.Now(), config.LastRotated, time.Minute)
+	assert.Equal(t, config.LastRotated.Add(24*time.Hour), config.NextRotation)
+
+	// A rotation from a configuration read before the previous rotation is skipped
+	stale := *config
+	stale.LastRotated = time.Time{}
+	require.NoError(t, b.rotateAdminCredential(ctx, reqStorage, "", &stale))
+
+	rotated, err := b.fetchAdminConfig(ctx, reqStorage, "")
+	require.NoError(t, err)
+	assert.Equal(t, config.Password, rotated.Password)
+
+	// Rotation details are shown in the admin config
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Contains(t, resp.Data, "last_rotated")
+	assert.Contains(t, resp.Data, "next_rotation")
+}
+
+func testConfigRotate_CloneUser_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnJSON([]security.User{{UserID: testConfigAdminUsername, Roles: []string{"nx-vault-admin"}}})
+		s.ExpectPost(userCreateURI).
+			WithBody(httpmock.RegexPattern(`"roles":\["nx-vault-admin"\]`)).
+			ReturnCode(httpmock.StatusOK)
+		s.ExpectGet(httpmock.RegexPattern(userGetURIRegex)).
+			Run(returnRequestedUser)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+		"rotation_mode":     rotationModeCloneUser,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, configRotatePath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	ctx := context.Background()
+	config, err := b.fetchAdminConfig(ctx, reqStorage, "")
+	require.NoError(t, err)
+	assert.Regexp(t, `^vault-admin-\d+-[a-z0-9]{8}$`, config.Username)
+	assert.NotEqual(t, testConfigAdminPassword, config.Password)
+
+	// The previous admin user is kept during the grace period
+	require.NoError(t, b.deleteRetiredAdminUsers(ctx, reqStorage))
+
+	retired, err := getRetiredAdminUser(ctx, reqStorage, testConfigAdminUsername)
+	require.NoError(t, err)
+	require.NotNil(t, retired)
+
+	// Then deleted
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, testConfigAdminUsername)).
+		ReturnCode(httpmock.StatusNoContent)
+
+	retired.DeleteAt = time.Now()
+	require.NoError(t, setRetiredAdminUser(ctx, reqStorage, retired))
+	require.NoError(t, b.deleteRetiredAdminUsers(ctx, reqStorage))
+
+	retired, err = getRetiredAdminUser(ctx, reqStorage, testConfigAdminUsername)
+	require.NoError(t, err)
+	assert.Nil(t, retired)
+}
+
+func testConfigRotate_CloneUser_WithMockApi_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnJSON([]security.User{{UserID: testConfigAdminUsername, Roles: []string{"nx-vault-admin"}}})
+		s.ExpectPost(userCreateURI).
+			ReturnCode(httpmock.StatusOK)
+		// The new credential is not accepted
+		s.ExpectGet(httpmock.RegexPattern(userGetURIRegex)).
+			ReturnCode(httpmock.StatusUnauthorized)
+		// The new user is cleaned up
+		s.ExpectDelete(httpmock.RegexPattern(userURIRegex)).
+			ReturnCode(httpmock.StatusNoContent)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+		"rotation_mode":     rotationModeCloneUser,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, configRotatePath, b, reqStorage, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not authenticate as user 'vault-admin-")
+	assert.Nil(t, resp)
+
+	// The current credential is kept
+	config, err := b.fetchAdminConfig(context.Background(), reqStorage, "")
+	require.NoError(t, err)
+	assert.Equal(t, testConfigAdminUsername, config.Username)
+	assert.Equal(t, testConfigAdminPassword, config.Password)
+}
+
+func testConfigRotate_Verify_WithMockApi_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusOK)
+		// The new password is not accepted
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusUnauthorized)
+		// Neither is the previous one, so it is restored
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusUnauthorized)
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
+			WithBody(testConfigAdminPassword).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionUpdate, configRotatePath, b, reqStorage, nil)
+	require.Error(t, err)
+	assert.Equal(t, "could not authenticate as user 'admin': HTTP: 401, ", err.Error())
+	assert.Nil(t, resp)
+
+	ctx := context.Background()
+
+	config, err := b.fetchAdminConfig(ctx, reqStorage, "")
+	require.NoError(t, err)
+	assert.Equal(t, testConfigAdminPassword, config.Password)
+
+	// The rotation has been rolled back
+	walIDs, err := framework.ListWAL(ctx, reqStorage)
+	require.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
+
+func testConfigRotate_WALRollback_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	newPassword := "Testing!456"
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		// The previous password is no longer accepted
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusUnauthorized)
+		// Restore it with the new password
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testConfigAdminUsername)).
+			WithHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(testConfigAdminUsername+":"+newPassword))).
+			WithBody(testConfigAdminPassword).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Simulate a rotation that changed the password on Nexus Repository but was never persisted
+	ctx := context.Background()
+	_, err = framework.PutWAL(ctx, reqStorage, adminPasswordWALKind, &adminPasswordWAL{
+		Username:    testConfigAdminUsername,
+		OldPassword: testConfigAdminPassword,
+		NewPassword: newPassword,
+	})
+	require.NoError(t, err)
+
+	resp, err = doAction(logical.RollbackOperation, "", b, reqStorage, testData{"immediate": true})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	walIDs, err := framework.ListWAL(ctx, reqStorage)
+	require.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
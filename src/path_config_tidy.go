@@ -0,0 +1,187 @@
+package nxr
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	configTidyPath      = "config/tidy"
+	defaultTidyInterval = 12 * 60 * 60 // 12h in seconds
+	defaultSafetyBuffer = 24 * 60 * 60 // 24h in seconds
+	minTidyInterval     = time.Minute
+	safetyBufferHelp    = "Optional. How long the lease of an issued user must have expired before the user is deleted. Default to `24h`."
+	userIDPrefixHelp    = "Prefix of the IDs of the users generated by the roles of this secrets engine, it must be unique to this mount."
+)
+
+// tidyConfig defines how the users left behind on Nexus Repository are tidied
+type tidyConfig struct {
+	UserIDPrefix string        `json:"user_id_prefix"`
+	PeriodicTidy bool          `json:"periodic_tidy"`
+	TidyInterval time.Duration `json:"tidy_interval"`
+	SafetyBuffer time.Duration `json:"safety_buffer"`
+	LastTidy     time.Time     `json:"last_tidy,omitempty"`
+}
+
+// toResponseData returns response data for the tidy configuration
+func (c *tidyConfig) toResponseData() map[string]interface{} {
+	respData := map[string]interface{}{
+		"user_id_prefix": c.UserIDPrefix,
+		"periodic_tidy":  c.PeriodicTidy,
+		"tidy_interval":  int64(c.TidyInterval.Seconds()),
+		"safety_buffer":  int64(c.SafetyBuffer.Seconds()),
+	}
+
+	if !c.LastTidy.IsZero() {
+		respData["last_tidy"] = c.LastTidy
+	}
+
+	return respData
+}
+
+// pathConfigTidy extends the Vault API with a `config/tidy`
+// endpoint for the backend.
+func pathConfigTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: configTidyPath,
+		Fields: map[string]*framework.FieldSchema{
+			"user_id_prefix": {
+				Type:        framework.TypeString,
+				Description: userIDPrefixHelp + " Required to tidy.",
+			},
+			"periodic_tidy": {
+				Type:        framework.TypeBool,
+				Description: "Optional. Tidy the orphaned users every `tidy_interval`. Default to `false`.",
+			},
+			"tidy_interval": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Optional. Interval between two periodic tidy operations. Default to `12h`, minimum `1m`.",
+			},
+			"safety_buffer": {
+				Type:        framework.TypeDurationSecond,
+				Description: safetyBufferHelp,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigTidyRead,
+				Summary:  "Examine the tidy configuration.",
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigTidyWrite,
+				Summary:  "Update the tidy configuration.",
+			},
+		},
+		HelpSynopsis:    pathConfigTidyHelpSynopsis,
+		HelpDescription: pathConfigTidyHelpDescription,
+	}
+}
+
+// pathConfigTidyRead reads the tidy configuration, or the defaults if it was never written
+func (b *backend) pathConfigTidyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	config, err := fetchTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: config.toResponseData(),
+	}, nil
+}
+
+// pathConfigTidyWrite updates the tidy configuration
+func (b *backend) pathConfigTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	config, err := fetchTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if userIDPrefix, ok := data.GetOk("user_id_prefix"); ok {
+		config.UserIDPrefix = userIDPrefix.(string)
+	}
+
+	if periodicTidy, ok := data.GetOk("periodic_tidy"); ok {
+		config.PeriodicTidy = periodicTidy.(bool)
+	}
+
+	if tidyInterval, ok := data.GetOk("tidy_interval"); ok {
+		config.TidyInterval = time.Duration(tidyInterval.(int)) * time.Second
+	}
+
+	if safetyBuffer, ok := data.GetOk("safety_buffer"); ok {
+		config.SafetyBuffer = time.Duration(safetyBuffer.(int)) * time.Second
+	}
+
+	// Verify
+	if config.TidyInterval < minTidyInterval {
+		return logical.ErrorResponse(`"tidy_interval" must be at least %s`, minTidyInterval), nil
+	}
+
+	if config.SafetyBuffer < 0 {
+		return logical.ErrorResponse(`"safety_buffer" cannot be negative`), nil
+	}
+
+	if config.PeriodicTidy && config.UserIDPrefix == "" {
+		return logical.ErrorResponse(`"user_id_prefix" is required when "periodic_tidy" is enabled`), nil
+	}
+
+	if err := setTidyConfig(ctx, req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// fetchTidyConfig fetches the tidy configuration, the defaults are returned if it was never written
+func fetchTidyConfig(ctx context.Context, s logical.Storage) (*tidyConfig, error) {
+	config := &tidyConfig{
+		TidyInterval: defaultTidyInterval * time.Second,
+		SafetyBuffer: defaultSafetyBuffer * time.Second,
+	}
+
+	entry, err := s.Get(ctx, configTidyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// setTidyConfig adds the tidy configuration to the Vault storage API
+func setTidyConfig(ctx context.Context, s logical.Storage, config *tidyConfig) error {
+	entry, err := logical.StorageEntryJSON(configTidyPath, config)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+const (
+	pathConfigTidyHelpSynopsis = `Configure the tidy of the orphaned Nexus Repository users.`
+
+	pathConfigTidyHelpDescription = `
+This endpoint configures how the users created by this secrets engine,
+and left behind on Nexus Repository (e.g. after a failed revocation), are tidied.
+The users are looked up by "user_id_prefix", which must be unique to this mount.
+The settings are the defaults of the "tidy" endpoint, which is also
+called every "tidy_interval" when "periodic_tidy" is enabled.
+`
+)
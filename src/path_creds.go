@@ -3,12 +3,16 @@ package nxr
 import (
 	"context"
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/template"
 	"github.com/hashicorp/vault/sdk/logical"
-	gopw "github.com/sethvargo/go-password/password"
 )
 
 const (
@@ -20,6 +24,25 @@ const (
 type userIdMetadata struct {
 	DisplayName string
 	RoleName    string
+
+	// UserID is the generated user ID, for the name and email templates only
+	UserID string
+
+	EntityID       string
+	EntityName     string
+	EntityMetadata map[string]string
+
+	// AliasMetadata is the metadata of the entity's alias of the role's auth mount, Metadata
+	// merges the entity and alias metadata, the alias one taking precedence
+	AliasMetadata map[string]string
+	Metadata      map[string]string
+
+	// Aliases are the metadata of all the entity's aliases, keyed by auth mount accessor
+	Aliases map[string]map[string]string
+
+	// MountType is the type of the auth mount of the alias
+	MountType   string
+	NamespaceID string
 }
 
 func pathCreds(b *backend) *framework.Path {
@@ -36,10 +59,14 @@ func pathCreds(b *backend) *framework.Path {
 				Description: "Name of the role.",
 				Required:    true,
 			},
-			// "ttl": {
-			// 	Type:        framework.TypeDurationSecond,
-			// 	Description: "Optional. Default lease for generated users. If not set or set to 0, will use system default.",
-			// },
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Optional. Lease for the generated user, capped by the role's max TTL. If not set or set to 0, will use the role's TTL.",
+			},
+			"format": {
+				Type:        framework.TypeString,
+				Description: fmt.Sprintf("Optional. Client config file rendered in `config_file` for the generated user, from the role's repository URLs: one of `%s`.", strings.Join(configFormats, "`, `")),
+			},
 		},
 
 		HelpSynopsis:    pathCredsHelpSyn,
@@ -63,32 +90,103 @@ func (b *backend) pathCredentialsRead(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse(fmt.Sprintf(`role "%s" does not exist`, roleName)), nil
 	}
 
-	return b.creadCred(ctx, req, roleEntry)
-}
+	ttl := time.Duration(d.Get("ttl").(int)) * time.Second
+	if ttl < 0 {
+		return logical.ErrorResponse(`"ttl" cannot be negative`), nil
+	}
+
+	var entity *logical.Entity
+	if req.EntityID != "" {
+		entity, err = b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return nil, fmt.Errorf("could not look up the requesting entity: %w", err)
+		}
+	}
+
+	if roleEntry.hasBoundMetadata() {
+		if err := roleEntry.checkBoundMetadata(entity); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrPermissionDenied
+		}
+	}
+
+	format := d.Get("format").(string)
+	if format == "" {
+		return b.creadCred(ctx, req, roleEntry, entity, ttl)
+	}
+
+	// the config file is checked to be renderable before a user is created for it
+	config, err := b.fetchAdminConfig(ctx, req.Storage, roleEntry.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return adminConfigNotFound(roleEntry.Connection), nil
+	}
+	repositoryURL, err := roleEntry.configFileURL(format, config.URL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp, err := b.creadCred(ctx, req, roleEntry, entity, ttl)
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
 
-func (b *backend) creadCred(ctx context.Context, req *logical.Request, role *nxrRoleEntry) (*logical.Response, error) {
-	client, err := b.getClient(ctx, req.Storage)
+	// build tools authenticate with the name code and pass code of a user token as username and password
+	username, password := resp.Data["user_id"], resp.Data["password"]
+	if roleEntry.CredentialType == credentialTypeUserToken {
+		username, password = resp.Data["name_code"], resp.Data["pass_code"]
+	}
+	resp.Data["config_file"], err = renderConfigFile(format, roleEntry.Name, repositoryURL, username.(string), password.(string))
 	if err != nil {
 		return nil, err
 	}
 
-	var displayName string
-	if req.DisplayName != "" {
-		re := regexp.MustCompile("[^[:alnum:]._-]")
-		displayName = re.ReplaceAllString(req.DisplayName, "-")
+	return resp, nil
+}
+
+func (b *backend) creadCred(ctx context.Context, req *logical.Request, role *nxrRoleEntry, entity *logical.Entity, ttl time.Duration) (*logical.Response, error) {
+	var cachePrefix string
+	if role.Cache {
+		b.cacheMutex.Lock()
+		defer b.cacheMutex.Unlock()
+
+		// reuse the user previously issued to the same requester
+		cachePrefix = userCachePrefix(role.Name, role.Connection, req)
+		cached, cacheKey, err := getCachedUser(ctx, req.Storage, cachePrefix)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			cached.Leases++
+			if err := setCachedUser(ctx, req.Storage, cacheKey, cached); err != nil {
+				return nil, err
+			}
+			resp, err := b.credResponse(role, &cached.nxrUser, ttl, cacheKey, cached.Expiration)
+			if err != nil {
+				return nil, err
+			}
+			if err := extendIssuedUserLease(ctx, req.Storage, role.Name, cached.UserID, b.leaseExpiry(resp.Secret)); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
 	}
 
+	metadata := userMetadata(req, role, entity)
+
 	up, _ := template.NewTemplate(template.Template(role.UserIdTemplate)) // this was verified in role config
-	generatedUserId, err := up.Generate(userIdMetadata{
-		DisplayName: displayName,
-		RoleName:    role.Name,
-	})
+	generatedUserId, err := up.Generate(metadata)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: allow user configs password complexity
-	randomPassword, err := gopw.Generate(64, 10, 0, false, true)
+	randomPassword, err := b.generatePassword(ctx, role.passwordConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -100,19 +198,264 @@ func (b *backend) creadCred(ctx context.Context, req *logical.Request, role *nxr
 		NexusRoles: role.NexusRoles,
 	}
 
-	err = createNxrUser(client, userReq)
+	metadata.UserID = generatedUserId
+	if err := role.renderUserTemplates(userReq, metadata); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	privileges, err := role.privileges()
+	if err != nil {
+		return nil, err
+	}
+
+	// record the user before creating it, so that it is deleted by the WAL
+	// rollback if the lease cannot be returned (e.g. Vault is shutdown)
+	walEntry := &userCreationWAL{
+		UserID:     generatedUserId,
+		RoleName:   role.Name,
+		Connection: role.Connection,
+	}
+	if len(privileges) > 0 {
+		walEntry.EphemeralRoleID = generatedUserId
+	}
+	if role.Cache {
+		walEntry.CacheKey = cachePrefix + generatedUserId
+	}
+
+	walID, err := framework.PutWAL(ctx, req.Storage, userCreationWALKind, walEntry)
 	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.createCred(ctx, req, client, role, userReq, privileges, ttl, walEntry.CacheKey)
+	if err != nil || resp.IsError() {
+		b.rollbackUserCreationNow(ctx, req.Storage, walID)
+		return resp, err
+	}
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// userMetadata returns the metadata of the requester, and of its entity if any,
+// that the user templates of the role can use
+func userMetadata(req *logical.Request, role *nxrRoleEntry, entity *logical.Entity) userIdMetadata {
+	metadata := userIdMetadata{
+		RoleName: role.Name,
+		EntityID: req.EntityID,
+	}
+
+	if req.DisplayName != "" {
+		re := regexp.MustCompile("[^[:alnum:]._-]")
+		metadata.DisplayName = re.ReplaceAllString(req.DisplayName, "-")
+	}
+
+	if entity != nil {
+		metadata.EntityName = entity.Name
+		metadata.EntityMetadata = entity.Metadata
+		metadata.NamespaceID = entity.NamespaceID
+		metadata.Aliases = make(map[string]map[string]string, len(entity.Aliases))
+		for _, alias := range entity.Aliases {
+			metadata.Aliases[alias.MountAccessor] = alias.Metadata
+		}
+		if alias := role.templateAlias(entity.Aliases); alias != nil {
+			metadata.AliasMetadata = alias.Metadata
+			metadata.MountType = alias.MountType
+		}
+	}
+
+	metadata.Metadata = make(map[string]string, len(metadata.EntityMetadata)+len(metadata.AliasMetadata))
+	maps.Copy(metadata.Metadata, metadata.EntityMetadata)
+	maps.Copy(metadata.Metadata, metadata.AliasMetadata)
+
+	return metadata
+}
+
+// templateAlias returns the alias whose metadata the user templates get: the one of the role's
+// bound_alias_mount_accessor, or the entity's only alias. As the auth mount of the request is
+// not known to the plugin, the aliases of several mounts are not merged, one could overwrite
+// the metadata of another.
+func (r *nxrRoleEntry) templateAlias(aliases []*logical.Alias) *logical.Alias {
+	if r.BoundAliasMountAccessor == "" {
+		if len(aliases) == 1 {
+			return aliases[0]
+		}
+		return nil
+	}
+
+	for _, alias := range aliases {
+		if alias.MountAccessor == r.BoundAliasMountAccessor {
+			return alias
+		}
+	}
+
+	return nil
+}
+
+// renderUserTemplates sets the first name, last name and email of the user from the
+// role's templates, the names default to the user ID and the email to the role's user_email
+func (r *nxrRoleEntry) renderUserTemplates(user *nxrUser, metadata userIdMetadata) error {
+	user.FirstName, user.LastName = user.UserID, user.UserID
+
+	for _, t := range []struct {
+		name     string
+		template string
+		value    *string
+	}{
+		{"first_name_template", r.FirstNameTemplate, &user.FirstName},
+		{"last_name_template", r.LastNameTemplate, &user.LastName},
+		{"user_email_template", r.UserEmailTemplate, &user.Email},
+	} {
+		if t.template == "" {
+			continue
+		}
+
+		up, _ := template.NewTemplate(template.Template(t.template)) // this was verified in role config
+		value, err := up.Generate(metadata)
+		if err != nil {
+			return fmt.Errorf(`unable to generate "%s": %w`, t.name, err)
+		}
+		if value == "" {
+			return fmt.Errorf(`"%s" generated an empty value`, t.name)
+		}
+		*t.value = value
+	}
+
+	if !emailValidationRegex.MatchString(user.Email) {
+		return fmt.Errorf(`"user_email_template" generated an invalid email "%s"`, user.Email)
+	}
+
+	return nil
+}
+
+// createCred creates the Nexus Repository user (and its dedicated role if the Vault role
+// grants privileges), records it then returns the leased response
+func (b *backend) createCred(ctx context.Context, req *logical.Request, client *nxrClient, role *nxrRoleEntry, userReq *nxrUser, privileges []string, ttl time.Duration, cacheKey string) (*logical.Response, error) {
+	// the privileges are granted through a role dedicated to the user, named after it
+	if len(privileges) > 0 {
+		err := client.createRole(security.Role{
+			ID:          userReq.UserID,
+			Name:        userReq.UserID,
+			Description: fmt.Sprintf("Created by Vault for the role %s", role.Name),
+			Privileges:  privileges,
+		})
+		if err != nil {
+			return logical.ErrorResponse("could not create Nexus Repository role"), nil
+		}
+		userReq.EphemeralRoleID = userReq.UserID
+		userReq.NexusRoles = append(slices.Clone(role.NexusRoles), userReq.UserID)
+	}
+
+	if err := createNxrUser(client, userReq); err != nil {
 		return logical.ErrorResponse("could not create Nexus Repository user"), nil
 	}
 
-	responseData, err := userReq.toResponseData()
+	switch role.CredentialType {
+	case credentialTypeUserToken:
+		config, err := b.fetchAdminConfig(ctx, req.Storage, role.Connection)
+		if err != nil {
+			return nil, err
+		}
+		userReq.Token, err = issueUserToken(config, userReq.UserID, userReq.Password)
+		if err != nil {
+			return logical.ErrorResponse("could not get user token of Nexus Repository user: %s", err), nil
+		}
+	case credentialTypeNuGetAPIKey:
+		config, err := b.fetchAdminConfig(ctx, req.Storage, role.Connection)
+		if err != nil {
+			return nil, err
+		}
+		userReq.NuGetAPIKey, err = issueNuGetAPIKey(config, userReq.UserID, userReq.Password)
+		if err != nil {
+			return logical.ErrorResponse("could not get NuGet API key of Nexus Repository user: %s", err), nil
+		}
+	}
+
+	issued := &issuedUser{
+		UserID:      userReq.UserID,
+		RoleName:    role.Name,
+		CreatedAt:   time.Now(),
+		DisplayName: req.DisplayName,
+		EntityID:    req.EntityID,
+
+		Connection:      role.Connection,
+		EphemeralRoleID: userReq.EphemeralRoleID,
+	}
+
+	if cacheKey == "" {
+		return b.issueCredResponse(ctx, req.Storage, role, userReq, issued, ttl, "", time.Time{})
+	}
+
+	maxTTL := role.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+
+	cached := &cachedUser{
+		nxrUser:    *userReq,
+		Expiration: time.Now().Add(maxTTL),
+		Leases:     1,
+	}
+	if err := setCachedUser(ctx, req.Storage, cacheKey, cached); err != nil {
+		return nil, err
+	}
+
+	return b.issueCredResponse(ctx, req.Storage, role, userReq, issued, ttl, cacheKey, cached.Expiration)
+}
+
+// issueCredResponse builds the leased response for a newly created user and records the issued user
+func (b *backend) issueCredResponse(ctx context.Context, s logical.Storage, role *nxrRoleEntry, user *nxrUser, issued *issuedUser, ttl time.Duration, cacheKey string, cacheExpiration time.Time) (*logical.Response, error) {
+	resp, err := b.credResponse(role, user, ttl, cacheKey, cacheExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	issued.LeaseExpiry = b.leaseExpiry(resp.Secret)
+	if err := setIssuedUser(ctx, s, issued); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// credResponse builds the leased response for a Nexus Repository user, the requested ttl
+// overrides the role's one, leases of a cached user are capped to the cache expiration
+func (b *backend) credResponse(role *nxrRoleEntry, user *nxrUser, ttl time.Duration, cacheKey string, cacheExpiration time.Time) (*logical.Response, error) {
+	responseData, err := user.toResponseData()
 	if err != nil {
 		return nil, err
 	}
 
 	internalData := map[string]interface{}{
 		"role":    role.Name,
-		"user_id": generatedUserId,
+		"user_id": user.UserID,
+	}
+
+	if user.EphemeralRoleID != "" {
+		internalData["nexus_role_id"] = user.EphemeralRoleID
+	}
+
+	// the lease is revoked as the role defined when it was issued
+	if role.RevocationMode != "" && role.RevocationMode != revocationModeDelete {
+		internalData["revocation_mode"] = role.RevocationMode
+	}
+	if role.RevocationMode == revocationModeDisableThenDelete {
+		internalData["disabled_user_retention"] = role.DisabledUserRetention.String()
+	}
+
+	if role.CredentialType != "" && role.CredentialType != credentialTypePassword {
+		internalData["credential_type"] = role.CredentialType
+	}
+
+	if role.Connection != "" {
+		internalData["connection"] = role.Connection
+	}
+
+	if cacheKey != "" {
+		internalData["cache_key"] = cacheKey
 	}
 
 	resp := b.Secret(nxrUserType).Response(responseData, internalData)
@@ -125,6 +468,31 @@ func (b *backend) creadCred(ctx context.Context, req *logical.Request, role *nxr
 		resp.Secret.MaxTTL = role.MaxTTL
 	}
 
+	if ttl > 0 {
+		maxTTL := resp.Secret.MaxTTL
+		if maxTTL <= 0 || maxTTL > b.System().MaxLeaseTTL() {
+			maxTTL = b.System().MaxLeaseTTL()
+		}
+		if ttl > maxTTL {
+			resp.AddWarning(fmt.Sprintf(`"ttl" is greater than the max TTL, capped to %s`, maxTTL))
+			ttl = maxTTL
+		}
+		resp.Secret.TTL = ttl
+		// the lease is renewed with the requested ttl
+		resp.Secret.InternalData["ttl"] = ttl.String()
+	}
+
+	if cacheKey != "" {
+		remaining := time.Until(cacheExpiration)
+		if resp.Secret.TTL <= 0 {
+			resp.Secret.TTL = b.System().DefaultLeaseTTL()
+		}
+		if resp.Secret.TTL > remaining {
+			resp.Secret.TTL = remaining
+		}
+		resp.Secret.MaxTTL = remaining
+	}
+
 	return resp, nil
 }
 
@@ -132,9 +500,12 @@ const (
 	pathCredsHelpSyn  = `Request Nexus Repository user credentials for a given Vault role.`
 	pathCredsHelpDesc = `
 This path creates dynamic Nexus Repository user credentials.
+An optional "ttl" parameter overrides the lease of the role, also on renewal,
+it is capped by the max TTL of the role and of the mount.
 The associated Vault role can be configured to create a new
-user bound to a list of existing Nexus security roles.
-The user created in Nexus Repository server will be
+user bound to a list of existing Nexus security roles, and to
+a Nexus security role created for the user from a list of privileges.
+The user (and its role) created in Nexus Repository server will be
 automatically deleted when the lease has expired.
 `
 )
@@ -1,9 +1,15 @@
 package nxr
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,12 +21,19 @@ const (
 	userCreateURI = "/service/rest/v1/security/users"
 	userURI       = "/service/rest/v1/security/users/%s"
 	testCredsPath = credsPath + testRoleName
+	roleCreateURI = "/service/rest/v1/security/roles"
+	roleURI       = "/service/rest/v1/security/roles/%s"
 )
 
 func Test_Creads(t *testing.T) {
 	t.Run("Creds_Fail", test_Creds_Fail)
 	t.Run("Creds_WithMockApi", testCreds_WithMockApi)
 	t.Run("Creds_WithMockApi_Fail", testCreds_WithMockApi_Fail)
+	t.Run("Creds_TTL_WithMockApi", testCreds_TTL_WithMockApi)
+	t.Run("Creds_Privileges_WithMockApi", testCreds_Privileges_WithMockApi)
+	t.Run("Creds_WALRollback_WithMockApi", testCreds_WALRollback_WithMockApi)
+	t.Run("Creds_UserTemplates_WithMockApi", testCreds_UserTemplates_WithMockApi)
+	t.Run("Creds_EntityMetadata_WithMockApi", testCreds_EntityMetadata_WithMockApi)
 }
 
 func test_Creds_Fail(t *testing.T) {
@@ -56,9 +69,10 @@ func testCreds_WithMockApi(t *testing.T) {
 	})(t)
 
 	config := &testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      mockSrv.URL(),
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
 	}
 	// Create base config
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, *config)
@@ -90,12 +104,16 @@ func testCreds_WithMockApi_Fail(t *testing.T) {
 	mockSrv := httpmock.New(func(s *httpmock.Server) {
 		s.ExpectPost(userCreateURI).
 			ReturnCode(httpmock.StatusBadGateway)
+		// The user creation is rolled back, in case the user was created despite the error
+		s.ExpectDelete(httpmock.RegexPattern(`^/service/rest/v1/security/users/v\.test-role\.`)).
+			ReturnCode(httpmock.StatusNotFound)
 	})(t)
 
 	config := &testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      mockSrv.URL(),
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
 	}
 	// Create base config
 	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, *config)
@@ -119,4 +137,301 @@ func testCreds_WithMockApi_Fail(t *testing.T) {
 	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
 	require.NoError(t, err)
 	assert.NotNil(t, resp)
+	assert.True(t, resp.IsError())
+
+	walIDs, err := framework.ListWAL(context.Background(), reqStorage)
+	require.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
+
+func testCreds_TTL_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI).
+			ReturnCode(httpmock.StatusOK).
+			Times(3)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+		"ttl":         10,
+		"max_ttl":     30,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Role's TTL
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, resp.Secret.TTL)
+
+	// Requested TTL
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, testData{"ttl": "20s"})
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, resp.Secret.TTL)
+	assert.Empty(t, resp.Warnings)
+
+	// The requested TTL is kept on renew
+	resp, err = doSecretAction(actionRenew, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, resp.Secret.TTL)
+
+	// Requested TTL capped by the role's max TTL
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, testData{"ttl": "1m"})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, resp.Secret.TTL)
+	assert.Len(t, resp.Warnings, 1)
+}
+
+func testCreds_Privileges_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	var createdRole security.Role
+	var createdUser security.User
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(roleCreateURI).
+			Run(func(r *http.Request) ([]byte, error) {
+				return nil, json.NewDecoder(r.Body).Decode(&createdRole)
+			})
+		s.ExpectPost(userCreateURI).
+			Run(func(r *http.Request) ([]byte, error) {
+				return nil, json.NewDecoder(r.Body).Decode(&createdUser)
+			})
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_privileges":      "nx-search-read",
+		"repository_privileges": "maven2:maven-releases:read,npm:npm-private:*",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+
+	userID := resp.Data["user_id"].(string)
+	assert.Equal(t, userID, createdRole.ID)
+	assert.Equal(t, []string{
+		"nx-search-read",
+		"nx-repository-view-maven2-maven-releases-read",
+		"nx-repository-view-npm-npm-private-*",
+	}, createdRole.Privileges)
+	assert.Equal(t, []string{userID}, createdUser.Roles)
+	assert.Equal(t, []string{userID}, resp.Data["nexus_roles"])
+
+	// The user and its role are deleted on revoke
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, userID))
+	mockSrv.ExpectDelete(fmt.Sprintf(roleURI, userID))
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testCreds_WALRollback_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	ctx := context.Background()
+
+	leakedUserID := "v-test-role-leaked"
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectDelete(fmt.Sprintf(userURI, leakedUserID))
+		// The role was not created
+		s.ExpectDelete(fmt.Sprintf(roleURI, leakedUserID)).
+			ReturnCode(httpmock.StatusNotFound)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// A creds request which did not return its lease
+	_, err = framework.PutWAL(ctx, reqStorage, userCreationWALKind, &userCreationWAL{
+		UserID:          leakedUserID,
+		RoleName:        testRoleName,
+		EphemeralRoleID: leakedUserID,
+	})
+	require.NoError(t, err)
+
+	resp, err = doAction(logical.RollbackOperation, "", b, reqStorage, testData{"immediate": true})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	walIDs, err := framework.ListWAL(ctx, reqStorage)
+	require.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
+
+func testCreds_UserTemplates_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "entity-ci",
+		Name:     "ci-pipeline",
+		Metadata: map[string]string{"team": "platform"},
+	}
+
+	var createdUser security.User
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI).
+			Run(func(r *http.Request) ([]byte, error) {
+				return nil, json.NewDecoder(r.Body).Decode(&createdUser)
+			})
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Invalid template
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":         testRoleNexusRoles,
+		"first_name_template": "{{ .EntityName",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `unable to initialize "first_name_template"`)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":         testRoleNexusRoles,
+		"first_name_template": "{{ .EntityName }}",
+		"last_name_template":  "{{ .EntityMetadata.team }} ({{ .RoleName }})",
+		"user_email_template": "{{ .UserID }}@example.org",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	readCreds := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: actionRead,
+			Path:      testCredsPath,
+			Storage:   reqStorage,
+			EntityID:  "entity-ci",
+		})
+	}
+
+	resp, err = readCreds()
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+
+	userID := resp.Data["user_id"].(string)
+	assert.Equal(t, userID, createdUser.UserID)
+	assert.Equal(t, "ci-pipeline", createdUser.FirstName)
+	assert.Equal(t, "platform ("+testRoleName+")", createdUser.LastName)
+	assert.Equal(t, userID+"@example.org", createdUser.EmailAddress)
+	assert.Equal(t, userID+"@example.org", resp.Data["email_address"])
+
+	// The generated email must be valid
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"user_email_template": "{{ .EntityName }}",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = readCreds()
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"user_email_template" generated an invalid email "ci-pipeline"`, resp.Error().Error())
+}
+
+func testCreds_EntityMetadata_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:          "entity-ci",
+		Name:        "ci-pipeline",
+		NamespaceID: "root",
+		Metadata:    map[string]string{"team": "platform", "project": "from-entity"},
+		Aliases: []*logical.Alias{
+			{
+				MountAccessor: "auth_jwt_b",
+				MountType:     "jwt",
+				Metadata:      map[string]string{"project_path": "group/app"},
+			},
+			{
+				MountAccessor: "auth_jwt_a",
+				MountType:     "jwt",
+				Metadata:      map[string]string{"project": "app", "project_path": "group/other"},
+			},
+		},
+	}
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":                testRoleNexusRoles,
+		"bound_alias_mount_accessor": "auth_jwt_b",
+		"user_id_template":           `{{ printf "ci-%s-%s-%s-%s-%s-%s" (index .Aliases "auth_jwt_a" "project") (.AliasMetadata.project_path | replace "/" "-") .Metadata.project .EntityName .MountType .NamespaceID }}`,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: actionRead,
+		Path:      testCredsPath,
+		Storage:   reqStorage,
+		EntityID:  "entity-ci",
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+
+	// The alias metadata are the ones of the role's auth mount,
+	// the other aliases are only available by mount accessor
+	assert.Equal(t, "ci-app-group-app-from-entity-ci-pipeline-jwt-root", resp.Data["user_id"])
+
+	// The aliases of several auth mounts are not merged
+	mockSrv.ExpectPost(userCreateURI)
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"bound_alias_mount_accessor": "",
+		"user_id_template":           `{{ printf "ci-%s-%d" .Metadata.project (len .AliasMetadata) }}`,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: actionRead,
+		Path:      testCredsPath,
+		Storage:   reqStorage,
+		EntityID:  "entity-ci",
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, "ci-from-entity-0", resp.Data["user_id"])
 }
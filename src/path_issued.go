@@ -0,0 +1,113 @@
+package nxr
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// pathIssued extends the Vault API with an `/issued`
+// endpoint for the backend.
+func pathIssued(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: issuedUsersPath + "?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathIssuedRolesList,
+				},
+			},
+			HelpSynopsis:    pathIssuedRolesListHelpSynopsis,
+			HelpDescription: pathIssuedRolesListHelpDescription,
+		},
+		{
+			Pattern: issuedUsersPath + framework.GenericNameRegex("name") + "/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeNameString,
+					Description: "Name of the role.",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathIssuedUsersList,
+				},
+			},
+			HelpSynopsis:    pathIssuedUsersListHelpSynopsis,
+			HelpDescription: pathIssuedUsersListHelpDescription,
+		},
+		{
+			Pattern: issuedUsersPath + framework.GenericNameRegex("name") + "/" + framework.MatchAllRegex("user_id"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeNameString,
+					Description: "Name of the role.",
+					Required:    true,
+				},
+				"user_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the Nexus Repository user.",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuedUserRead,
+				},
+			},
+			HelpSynopsis:    pathIssuedUserHelpSynopsis,
+			HelpDescription: pathIssuedUserHelpDescription,
+		},
+	}
+}
+
+// pathIssuedRolesList lists the roles which have issued users
+func (b *backend) pathIssuedRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, issuedUsersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+// pathIssuedUsersList lists the users issued for a role
+func (b *backend) pathIssuedUsersList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, issuedUsersPath+d.Get("name").(string)+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+// pathIssuedUserRead reads a user issued for a role
+func (b *backend) pathIssuedUserRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	user, err := getIssuedUser(ctx, req.Storage, d.Get("name").(string), d.Get("user_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: user.toResponseData(),
+	}, nil
+}
+
+const (
+	pathIssuedRolesListHelpSynopsis    = `List the roles which have issued Nexus Repository users.`
+	pathIssuedRolesListHelpDescription = `A list of role names, with a trailing slash, will be returned.`
+
+	pathIssuedUsersListHelpSynopsis    = `List the Nexus Repository users issued for a role.`
+	pathIssuedUsersListHelpDescription = `A list of the IDs of the users issued for the role, and not revoked yet, will be returned.`
+
+	pathIssuedUserHelpSynopsis    = `Read a Nexus Repository user issued for a role.`
+	pathIssuedUserHelpDescription = `
+This path returns when the user was created, the display name
+and entity ID of the requester, and when the user's lease expires.
+`
+)
@@ -0,0 +1,82 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+func Test_Issued(t *testing.T) {
+	t.Run("Issued_WithMockApi", testIssued_WithMockApi)
+}
+
+func testIssued_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+		"ttl":         60,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	creds, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   actionRead,
+		Path:        testCredsPath,
+		Storage:     reqStorage,
+		DisplayName: "token-ci",
+		EntityID:    "entity-ci",
+	})
+	require.NoError(t, err)
+	require.NoError(t, creds.Error())
+	userID := creds.Data["user_id"].(string)
+
+	resp, err = doAction(actionList, issuedUsersPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{testRoleName + "/"}, resp.Data["keys"])
+
+	resp, err = doAction(actionList, issuedUsersPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{userID}, resp.Data["keys"])
+
+	resp, err = doAction(actionRead, fmt.Sprintf("%s%s/%s", issuedUsersPath, testRoleName, userID), b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, userID, resp.Data["user_id"])
+	assert.Equal(t, testRoleName, resp.Data["role_name"])
+	assert.Equal(t, "token-ci", resp.Data["display_name"])
+	assert.Equal(t, "entity-ci", resp.Data["entity_id"])
+	assert.WithinDuration(t, time.Now(), resp.Data["created_at"].(time.Time), time.Minute)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), resp.Data["lease_expiry"].(time.Time), 10*time.Second)
+
+	// The issued user is forgotten once revoked
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, userID))
+	resp, err = doSecretAction(actionRevoke, creds.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionList, issuedUsersPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Data["keys"])
+}
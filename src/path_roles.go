@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
@@ -21,17 +23,42 @@ const (
 
 var emailValidationRegex = regexp.MustCompile(emailValidationRegexString)
 
+// repositoryActions are the actions of the repository view privileges
+// that Nexus Repository creates for every repository
+var repositoryActions = []string{"browse", "read", "edit", "add", "delete", "*"}
+
 // nxrRoleEntry defines the data required for a Vault role
 // to access and call the Nexus Repository API endpoints
 type nxrRoleEntry struct {
-	Name           string        `json:"name" mapstructure:"name"`
-	NexusRoles     []string      `json:"nexus_roles" mapstructure:"nexus_roles"`
-	UserIdTemplate string        `json:"user_id_template" mapstructure:"user_id_template"`
-	UserEmail      string        `json:"user_email" mapstructure:"user_email"`
-	TTL            time.Duration `json:"ttl" mapstructure:"ttl"`
-	MaxTTL         time.Duration `json:"max_ttl" mapstructure:"max_ttl"`
-	// NexusRolesCheck bool          `json:"nexus_roles_check" mapstructure:"nexus_roles_check"`
-	// Cache           bool          `json:"cache" mapstructure:"cache"`
+	Name            string        `json:"name" mapstructure:"name"`
+	Connection      string        `json:"connection,omitempty" mapstructure:"connection"`
+	NexusRoles      []string      `json:"nexus_roles" mapstructure:"nexus_roles"`
+	UserIdTemplate  string        `json:"user_id_template" mapstructure:"user_id_template"`
+	UserEmail       string        `json:"user_email" mapstructure:"user_email"`
+	TTL             time.Duration `json:"ttl" mapstructure:"ttl"`
+	MaxTTL          time.Duration `json:"max_ttl" mapstructure:"max_ttl"`
+	NexusRolesCheck bool          `json:"nexus_roles_check" mapstructure:"nexus_roles_check"`
+	Cache           bool          `json:"cache" mapstructure:"cache"`
+
+	FirstNameTemplate string `json:"first_name_template,omitempty" mapstructure:"first_name_template"`
+	LastNameTemplate  string `json:"last_name_template,omitempty" mapstructure:"last_name_template"`
+	UserEmailTemplate string `json:"user_email_template,omitempty" mapstructure:"user_email_template"`
+
+	NexusPrivileges      []string `json:"nexus_privileges,omitempty" mapstructure:"nexus_privileges"`
+	RepositoryPrivileges []string `json:"repository_privileges,omitempty" mapstructure:"repository_privileges"`
+
+	CredentialType        string        `json:"credential_type" mapstructure:"credential_type"`
+	RevocationMode        string        `json:"revocation_mode" mapstructure:"revocation_mode"`
+	DisabledUserRetention time.Duration `json:"disabled_user_retention" mapstructure:"disabled_user_retention"`
+
+	RepositoryURLs map[string]string `json:"repository_urls,omitempty" mapstructure:"repository_urls"`
+
+	BoundEntityMetadata map[string]string `json:"bound_entity_metadata,omitempty" mapstructure:"bound_entity_metadata"`
+	BoundAliasMetadata  map[string]string `json:"bound_alias_metadata,omitempty" mapstructure:"bound_alias_metadata"`
+
+	BoundAliasMountAccessor string `json:"bound_alias_mount_accessor,omitempty" mapstructure:"bound_alias_mount_accessor"`
+
+	passwordConfig `mapstructure:"-"`
 }
 
 // toResponseData returns response data for a role
@@ -46,17 +73,51 @@ func (r *nxrRoleEntry) toResponseData() (map[string]interface{}, error) {
 	// Using seconds as format for TTLs
 	respData["ttl"] = r.TTL.Seconds()
 	respData["max_ttl"] = r.MaxTTL.Seconds()
+	respData["disabled_user_retention"] = r.DisabledUserRetention.Seconds()
+
+	// roles created before the revocation modes delete their users
+	if r.RevocationMode == "" {
+		respData["revocation_mode"] = revocationModeDelete
+	}
+
+	if r.CredentialType == "" {
+		respData["credential_type"] = credentialTypePassword
+	}
+
+	for k, v := range r.passwordConfig.toResponseData() {
+		respData[k] = v
+	}
 
 	return respData, err
 }
 
+// privileges returns the Nexus Repository privileges granted through the ephemeral
+// role created for each lease, the repository tuples are resolved to the
+// `nx-repository-view-<format>-<repository>-<action>` privileges
+func (r *nxrRoleEntry) privileges() ([]string, error) {
+	privileges := slices.Clone(r.NexusPrivileges)
+
+	for _, tuple := range r.RepositoryPrivileges {
+		parts := strings.Split(tuple, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(`"%s" is not a valid repository privilege, expected "<format>:<repository>:<action>"`, tuple)
+		}
+		if !slices.Contains(repositoryActions, parts[2]) {
+			return nil, fmt.Errorf(`"%s" is not a valid repository privilege, action must be one of "%s"`, tuple, strings.Join(repositoryActions, `", "`))
+		}
+		privileges = append(privileges, fmt.Sprintf("nx-repository-view-%s-%s-%s", parts[0], parts[1], parts[2]))
+	}
+
+	return privileges, nil
+}
+
 // pathRoles extends the Vault API with a `/roles`
 // endpoint for the backend.
 func pathRoles(b *backend) []*framework.Path {
 	return []*framework.Path{
 		{
 			Pattern: rolesPath + framework.GenericNameRegex("name"),
-			Fields: map[string]*framework.FieldSchema{
+			Fields: withPasswordFields(map[string]*framework.FieldSchema{
 				"name": {
 					Type:        framework.TypeNameString,
 					Description: "Name of the role.",
@@ -64,8 +125,15 @@ func pathRoles(b *backend) []*framework.Path {
 				},
 				"nexus_roles": {
 					Type:        framework.TypeCommaStringSlice,
-					Description: "The Nexus Repository roles for the user.",
-					Required:    true,
+					Description: "The Nexus Repository roles for the user. Optional if \"nexus_privileges\" or \"repository_privileges\" is set.",
+				},
+				"nexus_privileges": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Optional. The Nexus Repository privileges granted to the user through a role created for each lease.",
+				},
+				"repository_privileges": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Optional. The repository privileges, as \"<format>:<repository>:<action>\", granted to the user through a role created for each lease.",
 				},
 				"user_id_template": {
 					Type:        framework.TypeString,
@@ -77,6 +145,18 @@ func pathRoles(b *backend) []*framework.Path {
 					Description: fmt.Sprintf("Optional. Email field for the user. Default to %s.", defaultUserEmail),
 					Default:     defaultUserEmail,
 				},
+				"first_name_template": {
+					Type:        framework.TypeString,
+					Description: "Optional. Template to generate the first name of the user, with the metadata of user_id_template and the generated `.UserID`. Default to the user ID.",
+				},
+				"last_name_template": {
+					Type:        framework.TypeString,
+					Description: "Optional. Template to generate the last name of the user, with the metadata of user_id_template and the generated `.UserID`. Default to the user ID.",
+				},
+				"user_email_template": {
+					Type:        framework.TypeString,
+					Description: "Optional. Template to generate the email of the user, with the metadata of user_id_template and the generated `.UserID`. Takes precedence over user_email.",
+				},
 				"ttl": {
 					Type:        framework.TypeDurationSecond,
 					Description: "Optional. Default lease for generated users. If not set or set to 0, will use system default.",
@@ -85,19 +165,54 @@ func pathRoles(b *backend) []*framework.Path {
 					Type:        framework.TypeDurationSecond,
 					Description: "Optional. Maximum lease time for generated users. If not set or set to 0, will use system default.",
 				},
-				// TODO: check if all nexus_roles are existing on Nexus Repository server to allow create the role
-				// "nexus_roles_check": {
-				// 	Type:        framework.TypeBool,
-				// 	Description: "Optional. Check if all nexus_roles are existing on Nexus Repository server before create the role. If not set or set to false, will skip the checking.",
-				// 	Default:     false,
-				// },
-				// TODO: cache and response the previous created user for next requests (within max_ttl) to reduce API abusing
-				// "cache": {
-				// 	Type:        framework.TypeBool,
-				// 	Description: "Optional. Cache the previous created user in this role (from a same bound claim user) to avoid creating to many users with the same privileges. Default to false.",
-				// 	Default:     false,
-				// },
-			},
+				"nexus_roles_check": {
+					Type:        framework.TypeBool,
+					Description: "Optional. Check if all nexus_roles are existing on Nexus Repository server before create the role. If not set or set to false, will skip the checking.",
+					Default:     false,
+				},
+				"credential_type": {
+					Type:          framework.TypeString,
+					Description:   "Optional. Credential returned for the generated users: `password`, or `user_token` for a Nexus Repository Pro user token (name code and pass code), or `nuget_api_key` for the user's NuGet API key, instead of the password. Default to `password`.",
+					Default:       credentialTypePassword,
+					AllowedValues: []interface{}{credentialTypePassword, credentialTypeUserToken, credentialTypeNuGetAPIKey},
+				},
+				"revocation_mode": {
+					Type:          framework.TypeString,
+					Description:   "Optional. How the users are revoked: `delete` deletes them, `disable` disables them, `disable_then_delete` disables them then deletes them after `disabled_user_retention`. Default to `delete`.",
+					Default:       revocationModeDelete,
+					AllowedValues: []interface{}{revocationModeDelete, revocationModeDisable, revocationModeDisableThenDelete},
+				},
+				"disabled_user_retention": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Optional. How long the users disabled on revoke are kept before being deleted, in `disable_then_delete` revocation mode. Default to `720h` (30 days).",
+					Default:     defaultDisabledUserRetention,
+				},
+				"repository_urls": {
+					Type:        framework.TypeKVPairs,
+					Description: "Optional. Repository URLs rendered in the client config files returned by a creds read with \"format\", keyed by format (e.g. `npmrc=https://nexus.example.org/repository/npm-group/`).",
+				},
+				"bound_entity_metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: "Optional. Metadata that the requesting entity must have, as \"<key>=<glob>\" pairs (e.g. `team=platform-*`). All the pairs must match.",
+				},
+				"bound_alias_metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: "Optional. Metadata that one of the requesting entity's aliases must have, as \"<key>=<glob>\" pairs (e.g. `project_path=group/*`). All the pairs must match the same alias.",
+				},
+				"bound_alias_mount_accessor": {
+					Type:        framework.TypeString,
+					Description: "Optional. Accessor of the auth mount whose alias must match bound_alias_metadata, and whose alias metadata the user templates get. Default to any of the entity's aliases.",
+				},
+				"cache": {
+					Type:        framework.TypeBool,
+					Description: "Optional. Cache the previous created user in this role (from a same bound claim user) to avoid creating to many users with the same privileges. Default to false.",
+					Default:     false,
+				},
+				"connection": {
+					Type:        framework.TypeString,
+					Description: connectionHelp,
+				},
+			}),
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
 					Callback: b.pathRolesRead,
@@ -149,18 +264,23 @@ func (b *backend) pathRolesRead(ctx context.Context, req *logical.Request, d *fr
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.RUnlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	entry, err := getRole(ctx, req.Storage, d.Get("name").(string))
 	if err != nil {
 		return nil, err
 	}
-	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
-	}
 
-	entry, err := getRole(ctx, req.Storage, d.Get("name").(string))
+	connection := ""
+	if entry != nil {
+		connection = entry.Connection
+	}
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
+	if config == nil {
+		return adminConfigNotFound(connection), nil
+	}
+
 	if entry == nil {
 		return nil, nil
 	}
@@ -180,14 +300,6 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.RUnlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
-	if err != nil {
-		return nil, err
-	}
-	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
-	}
-
 	name := d.Get("name").(string)
 	if name == "" {
 		return logical.ErrorResponse("missing role name"), nil
@@ -203,18 +315,95 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		}
 	}
 
+	if connection, ok := d.GetOk("connection"); ok {
+		entry.Connection = connection.(string)
+	}
+
+	config, err := b.fetchAdminConfig(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return adminConfigNotFound(entry.Connection), nil
+	}
+
 	createOperation := (req.Operation == logical.CreateOperation)
 
 	if nexusRolesRaw, ok := d.GetOk("nexus_roles"); ok {
 		entry.NexusRoles = nexusRolesRaw.([]string)
-	} else if !ok && createOperation {
-		return logical.ErrorResponse(`missing "nexus_roles" in role definition`), nil
+	}
+
+	if nexusPrivilegesRaw, ok := d.GetOk("nexus_privileges"); ok {
+		entry.NexusPrivileges = nexusPrivilegesRaw.([]string)
+	}
+
+	if repositoryPrivilegesRaw, ok := d.GetOk("repository_privileges"); ok {
+		entry.RepositoryPrivileges = repositoryPrivilegesRaw.([]string)
+	}
+
+	if nexusRolesCheck, ok := d.GetOk("nexus_roles_check"); ok {
+		entry.NexusRolesCheck = nexusRolesCheck.(bool)
+	} else if createOperation {
+		entry.NexusRolesCheck = d.Get("nexus_roles_check").(bool)
+	}
+
+	// the retention is defaulted for the roles created before the revocation modes too
+	if disabledUserRetention, ok := d.GetOk("disabled_user_retention"); ok {
+		entry.DisabledUserRetention = time.Duration(disabledUserRetention.(int)) * time.Second
+	} else if createOperation || entry.RevocationMode == "" {
+		entry.DisabledUserRetention = time.Duration(d.Get("disabled_user_retention").(int)) * time.Second
+	}
+
+	if credentialType, ok := d.GetOk("credential_type"); ok {
+		entry.CredentialType = credentialType.(string)
+	} else if createOperation {
+		entry.CredentialType = d.Get("credential_type").(string)
+	}
+
+	if revocationMode, ok := d.GetOk("revocation_mode"); ok {
+		entry.RevocationMode = revocationMode.(string)
+	} else if createOperation {
+		entry.RevocationMode = d.Get("revocation_mode").(string)
+	}
+
+	if repositoryURLs, ok := d.GetOk("repository_urls"); ok {
+		entry.RepositoryURLs = repositoryURLs.(map[string]string)
+	}
+
+	if boundEntityMetadata, ok := d.GetOk("bound_entity_metadata"); ok {
+		entry.BoundEntityMetadata = boundEntityMetadata.(map[string]string)
+	}
+
+	if boundAliasMetadata, ok := d.GetOk("bound_alias_metadata"); ok {
+		entry.BoundAliasMetadata = boundAliasMetadata.(map[string]string)
+	}
+
+	if boundAliasMountAccessor, ok := d.GetOk("bound_alias_mount_accessor"); ok {
+		entry.BoundAliasMountAccessor = boundAliasMountAccessor.(string)
+	}
+
+	if cache, ok := d.GetOk("cache"); ok {
+		entry.Cache = cache.(bool)
+	} else if createOperation {
+		entry.Cache = d.Get("cache").(bool)
 	}
 
 	entry.UserIdTemplate = d.Get("user_id_template").(string)
 
 	entry.UserEmail = d.Get("user_email").(string)
 
+	if firstNameTemplate, ok := d.GetOk("first_name_template"); ok {
+		entry.FirstNameTemplate = firstNameTemplate.(string)
+	}
+
+	if lastNameTemplate, ok := d.GetOk("last_name_template"); ok {
+		entry.LastNameTemplate = lastNameTemplate.(string)
+	}
+
+	if userEmailTemplate, ok := d.GetOk("user_email_template"); ok {
+		entry.UserEmailTemplate = userEmailTemplate.(string)
+	}
+
 	if ttlRaw, ok := d.GetOk("ttl"); ok {
 		entry.TTL = time.Duration(ttlRaw.(int)) * time.Second
 	} else if createOperation {
@@ -227,11 +416,57 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		entry.MaxTTL = time.Duration(d.Get("max_ttl").(int)) * time.Second
 	}
 
+	entry.passwordConfig.update(d)
+
 	// Verifying
+	privileges, err := entry.privileges()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if len(entry.NexusRoles) == 0 && len(privileges) == 0 {
+		return logical.ErrorResponse(`missing "nexus_roles" in role definition`), nil
+	}
+
+	if err := validateCredentialType(entry.CredentialType); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := validateRepositoryURLs(entry.RepositoryURLs); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := validateBoundMetadata("bound_entity_metadata", entry.BoundEntityMetadata); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := validateBoundMetadata("bound_alias_metadata", entry.BoundAliasMetadata); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	switch entry.RevocationMode {
+	case "", revocationModeDelete, revocationModeDisable, revocationModeDisableThenDelete:
+	default:
+		return logical.ErrorResponse(`"revocation_mode" must be one of "%s", "%s" or "%s"`, revocationModeDelete, revocationModeDisable, revocationModeDisableThenDelete), nil
+	}
+
 	if _, err := template.NewTemplate(template.Template(entry.UserIdTemplate)); err != nil {
 		return logical.ErrorResponse(`unable to initialize "user_id_template"`), err
 	}
 
+	for _, t := range [][2]string{
+		{"first_name_template", entry.FirstNameTemplate},
+		{"last_name_template", entry.LastNameTemplate},
+		{"user_email_template", entry.UserEmailTemplate},
+	} {
+		if t[1] == "" {
+			continue
+		}
+		if _, err := template.NewTemplate(template.Template(t[1])); err != nil {
+			return logical.ErrorResponse(`unable to initialize "%s": %s`, t[0], err), nil
+		}
+	}
+
 	if !emailValidationRegex.MatchString(entry.UserEmail) {
 		return logical.ErrorResponse(`"user_email" is not valid`), nil
 	}
@@ -240,6 +475,20 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		return logical.ErrorResponse(`"ttl" cannot be greater than "max_ttl"`), nil
 	}
 
+	if err := b.validatePasswordConfig(ctx, entry.passwordConfig); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if entry.NexusRolesCheck {
+		unknownRoles, err := findUnknownNexusRoles(config, entry.NexusRoles)
+		if err != nil {
+			return logical.ErrorResponse(`could not check "nexus_roles" on Nexus Repository: %s`, err), nil
+		}
+		if len(unknownRoles) > 0 {
+			return logical.ErrorResponse(`"nexus_roles" not found on Nexus Repository: %s`, strings.Join(unknownRoles, ", ")), nil
+		}
+	}
+
 	if err := setRole(ctx, req.Storage, name, entry); err != nil {
 		return nil, err
 	}
@@ -254,15 +503,25 @@ func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *
 	defer b.configMutex.RUnlock()
 	defer b.rolesMutex.RUnlock()
 
-	config, err := b.fetchAdminConfig(ctx, req.Storage)
+	name := d.Get("name").(string)
+	entry, err := getRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	connection := ""
+	if entry != nil {
+		connection = entry.Connection
+	}
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
 	if config == nil {
-		return logical.ErrorResponse("admin configuration not found"), nil
+		return adminConfigNotFound(connection), nil
 	}
 
-	err = req.Storage.Delete(ctx, rolesPath+d.Get("name").(string))
+	err = req.Storage.Delete(ctx, rolesPath+name)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +529,29 @@ func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *
 	return nil, nil
 }
 
+// findUnknownNexusRoles returns the roles which do not exist on Nexus Repository
+func findUnknownNexusRoles(config *adminConfig, nexusRoles []string) ([]string, error) {
+	// the client is built from the fetched config as the caller holds configMutex
+	client, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	existingRoles, err := client.listRoleIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	unknownRoles := []string{}
+	for _, role := range nexusRoles {
+		if !slices.Contains(existingRoles, role) {
+			unknownRoles = append(unknownRoles, role)
+		}
+	}
+
+	return unknownRoles, nil
+}
+
 // setRole adds the role to the Vault storage API
 func setRole(ctx context.Context, s logical.Storage, name string, roleEntry *nxrRoleEntry) error {
 	entry, err := logical.StorageEntryJSON(rolesPath+name, roleEntry)
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
 )
 
 const (
@@ -19,19 +22,22 @@ const (
 	testRoleNexusRolesUpdate     = "nx-test1,nx-test2,nx-test3"
 	testRoleUserIdTemplateUpdate = `{{ printf "v-%s-%s-%s-%s" (.RoleName | truncate 64) (.DisplayName | truncate 64) (unix_time) (random 24) | truncate 256 | lowercase }}`
 	testRoleUserEmailUpdate      = "me@example.org"
+	rolesListURI                 = "/service/rest/v1/security/roles"
 )
 
 func Test_Roles(t *testing.T) {
 	t.Run("Roles_SimpleCRUD", testRoles_SimpleCRUD)
 	t.Run("Roles_Create_Fail", testRoles_Create_MissingRequireFields)
 	t.Run("Roles_Update_Fail", testRoles_Update_Fail)
+	t.Run("Roles_NexusRolesCheck_WithMockApi", testRoles_NexusRolesCheck_WithMockApi)
 }
 
 func initBaseAdminConfig(b logical.Backend, s logical.Storage) (*logical.Response, error) {
 	return doAction(actionCreate, configAdminPath, b, s, testData{
-		"username": testConfigAdminUsername,
-		"password": testConfigAdminPassword,
-		"url":      testConfigAdminURL,
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
 	})
 }
 
@@ -122,6 +128,32 @@ func testRoles_Create_MissingRequireFields(t *testing.T) {
 			},
 			expectedError: `missing "nexus_roles" in role definition`,
 		},
+		{
+			data: &testData{
+				"repository_privileges": "maven2:maven-releases",
+			},
+			expectedError: `"maven2:maven-releases" is not a valid repository privilege, expected "<format>:<repository>:<action>"`,
+		},
+		{
+			data: &testData{
+				"repository_privileges": "maven2:maven-releases:write",
+			},
+			expectedError: `"maven2:maven-releases:write" is not a valid repository privilege, action must be one of "browse", "read", "edit", "add", "delete", "*"`,
+		},
+		{
+			data: &testData{
+				"nexus_roles":     testRoleNexusRoles,
+				"revocation_mode": "archive",
+			},
+			expectedError: `"revocation_mode" must be one of "delete", "disable" or "disable_then_delete"`,
+		},
+		{
+			data: &testData{
+				"nexus_roles":             testRoleNexusRoles,
+				"disabled_user_retention": -1,
+			},
+			expectedError: `Field validation failed: error converting input -1 for field "disabled_user_retention": cannot provide negative value '-1'`,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -218,3 +250,53 @@ func testRoles_Update_Fail(t *testing.T) {
 		assert.Equal(t, tc.expectedError, resp.Error().Error())
 	}
 }
+
+func testRoles_NexusRolesCheck_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectGet(rolesListURI).
+			ReturnJSON([]security.Role{{ID: "nx-test1"}, {ID: "nx-test3"}})
+		s.ExpectGet(rolesListURI).
+			ReturnJSON([]security.Role{{ID: "nx-test1"}, {ID: "nx-test2"}, {ID: "nx-test3"}})
+		s.ExpectGet(rolesListURI).
+			ReturnCode(httpmock.StatusForbidden)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	roleData := testData{
+		"nexus_roles":       testRoleNexusRoles,
+		"nexus_roles_check": true,
+	}
+
+	// Unknown role
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, roleData)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"nexus_roles" not found on Nexus Repository: nx-test2`, resp.Error().Error())
+
+	// All roles exist
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, roleData)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, rolesPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, resp.Data["nexus_roles_check"])
+
+	// Roles cannot be listed
+	resp, err = doAction(actionUpdate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRolesUpdate,
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), `could not check "nexus_roles" on Nexus Repository: could not list roles: HTTP: 403`)
+}
@@ -0,0 +1,88 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	staticCredsPath = "static-creds/"
+)
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: staticCredsPath + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the static role.",
+				Required:    true,
+			},
+		},
+
+		HelpSynopsis:    pathStaticCredsHelpSyn,
+		HelpDescription: pathStaticCredsHelpDesc,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStaticCredsRead,
+			},
+		},
+	}
+}
+
+func (b *backend) pathStaticCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRolesMutex.RLock()
+	defer b.staticRolesMutex.RUnlock()
+
+	roleName := d.Get("name").(string)
+
+	roleEntry, err := getStaticRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf(`static role "%s" does not exist`, roleName)), nil
+	}
+
+	ttl := time.Until(roleEntry.nextRotation())
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	respData := map[string]interface{}{
+		"user_id":             roleEntry.UserID,
+		"last_vault_rotation": roleEntry.LastVaultRotation,
+		"rotation_period":     roleEntry.RotationPeriod.Seconds(),
+		"ttl":                 int64(ttl.Seconds()),
+	}
+
+	// the password is never returned along with a user token or a NuGet API key
+	switch {
+	case roleEntry.Token != nil:
+		respData["name_code"] = roleEntry.Token.NameCode
+		respData["pass_code"] = roleEntry.Token.PassCode
+	case roleEntry.NuGetAPIKey != "":
+		respData["nuget_api_key"] = roleEntry.NuGetAPIKey
+	default:
+		respData["password"] = roleEntry.Password
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+const (
+	pathStaticCredsHelpSyn  = `Request the current Nexus Repository user credentials for a given static role.`
+	pathStaticCredsHelpDesc = `
+This path returns the current password (or user token) of the existing Nexus
+Repository user bound to the static role. The password is rotated by Vault
+every "rotation_period", "ttl" is the time left before the next rotation.
+`
+)
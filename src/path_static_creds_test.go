@@ -0,0 +1,78 @@
+package nxr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	testStaticCredsPath = staticCredsPath + testStaticRoleName
+)
+
+func Test_StaticCreds(t *testing.T) {
+	t.Run("StaticCreds_Fail", testStaticCreds_Fail)
+	t.Run("StaticCreds_WithMockApi", testStaticCreds_WithMockApi)
+}
+
+func testStaticCreds_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// Static role does not exist
+	expectedError := fmt.Sprintf(`static role "%s" does not exist`, testStaticRoleName)
+	resp, err := doAction(actionRead, testStaticCredsPath, b, reqStorage, nil)
+
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, expectedError, resp.Error().Error())
+
+	// Unsuported operations
+	expectedError = `unsupported operation`
+	for _, v := range []logical.Operation{actionCreate, actionUpdate, actionDelete, actionList} {
+		resp, err = doAction(v, testStaticCredsPath, b, reqStorage, nil)
+
+		require.Error(t, err)
+		assert.Nil(t, resp)
+		assert.Equal(t, expectedError, err.Error())
+	}
+}
+
+func testStaticCreds_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID)).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id":         testStaticRoleUserID,
+		"rotation_period": "1h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testStaticCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+	require.NoError(t, resp.Error())
+	assert.Nil(t, resp.Secret) // static credentials are not leased
+	assert.Equal(t, testStaticRoleUserID, resp.Data["user_id"])
+	assert.Len(t, resp.Data["password"], 64)
+	assert.InDelta(t, 3600, resp.Data["ttl"], 5)
+}
@@ -0,0 +1,472 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	staticRolesPath          = "static-roles/"
+	defaultRotationPeriod    = 24 * 60 * 60 // 24h in seconds
+	staticRotationPeriodHelp = "Optional. Period for automatically rotating the password of the Nexus Repository user. Default to `24h`, minimum `1m`."
+)
+
+// nxrStaticRoleEntry defines a Vault role bound to
+// a pre-existing user on Nexus Repository
+type nxrStaticRoleEntry struct {
+	Name              string        `json:"name" mapstructure:"name"`
+	UserID            string        `json:"user_id" mapstructure:"user_id"`
+	Connection        string        `json:"connection,omitempty" mapstructure:"connection"`
+	RotationPeriod    time.Duration `json:"rotation_period" mapstructure:"rotation_period"`
+	LastVaultRotation time.Time     `json:"last_vault_rotation" mapstructure:"-"`
+	Password          string        `json:"password" mapstructure:"-"`
+	CredentialType    string        `json:"credential_type" mapstructure:"credential_type"`
+	Token             *userToken    `json:"user_token,omitempty" mapstructure:"-"`
+	NuGetAPIKey       string        `json:"nuget_api_key,omitempty" mapstructure:"-"`
+
+	passwordConfig `mapstructure:"-"`
+}
+
+// toResponseData returns response data for a static role
+func (r *nxrStaticRoleEntry) toResponseData() (map[string]interface{}, error) {
+	respData := map[string]interface{}{}
+
+	err := mapstructure.Decode(r, &respData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Using seconds as format for TTLs
+	respData["rotation_period"] = r.RotationPeriod.Seconds()
+	respData["last_vault_rotation"] = r.LastVaultRotation
+
+	if r.CredentialType == "" {
+		respData["credential_type"] = credentialTypePassword
+	}
+
+	for k, v := range r.passwordConfig.toResponseData() {
+		respData[k] = v
+	}
+
+	return respData, err
+}
+
+// nextRotation returns the time when the password of the static role is due to be rotated
+func (r *nxrStaticRoleEntry) nextRotation() time.Time {
+	return r.LastVaultRotation.Add(r.RotationPeriod)
+}
+
+// pathStaticRoles extends the Vault API with a `/static-roles`
+// endpoint for the backend.
+func pathStaticRoles(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: staticRolesPath + framework.GenericNameRegex("name"),
+			Fields: withPasswordFields(map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeNameString,
+					Description: "Name of the static role.",
+					Required:    true,
+				},
+				"user_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the existing Nexus Repository user managed by this role.",
+					Required:    true,
+				},
+				"rotation_period": {
+					Type:        framework.TypeDurationSecond,
+					Description: staticRotationPeriodHelp,
+					Default:     defaultRotationPeriod,
+				},
+				"credential_type": {
+					Type:          framework.TypeString,
+					Description:   "Optional. Credential returned for the user: `password`, or `user_token` for a Nexus Repository Pro user token (name code and pass code), or `nuget_api_key` for the user's NuGet API key, reset on each rotation, instead of the password. Default to `password`.",
+					Default:       credentialTypePassword,
+					AllowedValues: []interface{}{credentialTypePassword, credentialTypeUserToken, credentialTypeNuGetAPIKey},
+				},
+				"connection": {
+					Type:        framework.TypeString,
+					Description: connectionHelp,
+				},
+			}),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesDelete,
+				},
+			},
+			HelpSynopsis:    pathStaticRolesHelpSynopsis,
+			HelpDescription: pathStaticRolesHelpDescription,
+			ExistenceCheck:  b.pathExistenceCheck,
+		},
+		{
+			Pattern: staticRolesPath + "?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesList,
+				},
+			},
+			HelpSynopsis:    pathStaticRolesListHelpSynopsis,
+			HelpDescription: pathStaticRolesListHelpDescription,
+		},
+	}
+}
+
+// pathStaticRolesList makes a request to Vault storage to retrieve a list of static roles for the backend
+func (b *backend) pathStaticRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRolesMutex.RLock()
+	defer b.staticRolesMutex.RUnlock()
+
+	entries, err := req.Storage.List(ctx, staticRolesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+// pathStaticRolesRead makes a request to Vault storage to read a static role and return response data
+func (b *backend) pathStaticRolesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRolesMutex.RLock()
+	defer b.staticRolesMutex.RUnlock()
+
+	entry, err := getStaticRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	respData, err := entry.toResponseData()
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+// pathStaticRolesWrite makes a request to Vault storage to update a static role.
+// The password of the bound Nexus Repository user is rotated immediately when
+// the role is created or the user changes, so that only Vault knows it.
+func (b *backend) pathStaticRolesWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRolesMutex.Lock()
+	defer b.staticRolesMutex.Unlock()
+
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing role name"), nil
+	}
+
+	entry, err := getStaticRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		entry = &nxrStaticRoleEntry{
+			Name: name,
+		}
+	}
+
+	createOperation := (req.Operation == logical.CreateOperation)
+
+	rotateNow := createOperation
+	if connectionRaw, ok := d.GetOk("connection"); ok {
+		connection := connectionRaw.(string)
+		if connection != entry.Connection {
+			rotateNow = true
+		}
+		entry.Connection = connection
+	}
+
+	config, err := b.fetchAdminConfig(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return adminConfigNotFound(entry.Connection), nil
+	}
+
+	if userIDRaw, ok := d.GetOk("user_id"); ok {
+		userID := userIDRaw.(string)
+		if userID != entry.UserID {
+			rotateNow = true
+		}
+		entry.UserID = userID
+	}
+
+	if rotationPeriodRaw, ok := d.GetOk("rotation_period"); ok {
+		entry.RotationPeriod = time.Duration(rotationPeriodRaw.(int)) * time.Second
+	} else if createOperation {
+		entry.RotationPeriod = time.Duration(d.Get("rotation_period").(int)) * time.Second
+	}
+
+	if credentialType, ok := d.GetOk("credential_type"); ok {
+		currentType := entry.CredentialType
+		if currentType == "" {
+			currentType = credentialTypePassword
+		}
+		if credentialType.(string) != currentType {
+			rotateNow = true
+		}
+		entry.CredentialType = credentialType.(string)
+	} else if createOperation {
+		entry.CredentialType = d.Get("credential_type").(string)
+	}
+
+	entry.passwordConfig.update(d)
+
+	// Verifying
+	if entry.UserID == "" {
+		return logical.ErrorResponse(`missing "user_id" in static role definition`), nil
+	}
+
+	// rotating the password of the admin user would lock the mount out of Nexus Repository
+	if entry.UserID == config.Username {
+		return logical.ErrorResponse(`"user_id" cannot be the admin user of the connection`), nil
+	}
+
+	if err := validateCredentialType(entry.CredentialType); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if entry.RotationPeriod < minRotationPeriod {
+		return logical.ErrorResponse(`"rotation_period" must be at least %s`, minRotationPeriod), nil
+	}
+
+	if err := b.validatePasswordConfig(ctx, entry.passwordConfig); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if rotateNow {
+		if err := b.rotateStaticRole(ctx, req.Storage, entry); err != nil {
+			return logical.ErrorResponse(`could not rotate password of Nexus Repository user "%s"`, entry.UserID), err
+		}
+		return nil, nil
+	}
+
+	if err := setStaticRole(ctx, req.Storage, name, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathStaticRolesDelete makes a request to Vault storage to delete a static role,
+// the user on Nexus Repository is left untouched
+func (b *backend) pathStaticRolesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRolesMutex.Lock()
+	defer b.staticRolesMutex.Unlock()
+
+	err := req.Storage.Delete(ctx, staticRolesPath+d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// rotateStaticRole changes the password of the Nexus Repository user bound to
+// the static role and persists the new password, the caller must hold staticRolesMutex
+func (b *backend) rotateStaticRole(ctx context.Context, s logical.Storage, entry *nxrStaticRoleEntry) error {
+	client, err := b.getClient(ctx, s, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	newPw, err := b.generatePassword(ctx, entry.passwordConfig)
+	if err != nil {
+		return err
+	}
+
+	walID, err := framework.PutWAL(ctx, s, staticPasswordWALKind, &staticPasswordWAL{
+		RoleName:    entry.Name,
+		Connection:  entry.Connection,
+		UserID:      entry.UserID,
+		OldPassword: entry.Password,
+	})
+	if err != nil {
+		return err
+	}
+
+	// On failure the password may have been changed anyway (e.g. timed out request),
+	// the WAL entry is left to the periodic rollback
+	if err := client.changeUserPassword(entry.UserID, newPw); err != nil {
+		return err
+	}
+
+	if err := b.persistStaticPassword(ctx, s, client, entry, newPw); err != nil {
+		b.rollbackStaticPasswordNow(ctx, s, walID)
+		return err
+	}
+
+	if err := framework.DeleteWAL(ctx, s, walID); err != nil {
+		// the rollback finds the new password persisted, and does nothing
+		b.Logger().Warn("could not delete WAL entry of static role password rotation", "wal_id", walID, "error", err)
+	}
+
+	return nil
+}
+
+// persistStaticPassword issues the credential of the static role's user with its
+// new password, then stores the static role
+func (b *backend) persistStaticPassword(ctx context.Context, s logical.Storage, client *nxrClient, entry *nxrStaticRoleEntry, newPw string) error {
+	// the previous user token or NuGet API key is invalidated along with the previous password
+	entry.Token = nil
+	entry.NuGetAPIKey = ""
+	switch entry.CredentialType {
+	case credentialTypeUserToken:
+		if err := client.resetUserToken(entry.UserID); err != nil && !isNotFound(err) {
+			return err
+		}
+
+		config, err := b.fetchAdminConfig(ctx, s, entry.Connection)
+		if err != nil {
+			return err
+		}
+		entry.Token, err = issueUserToken(config, entry.UserID, newPw)
+		if err != nil {
+			return err
+		}
+	case credentialTypeNuGetAPIKey:
+		config, err := b.fetchAdminConfig(ctx, s, entry.Connection)
+		if err != nil {
+			return err
+		}
+		if err := deleteNuGetAPIKey(config, entry.UserID, newPw); err != nil {
+			return err
+		}
+		entry.NuGetAPIKey, err = issueNuGetAPIKey(config, entry.UserID, newPw)
+		if err != nil {
+			return err
+		}
+	}
+
+	entry.Password = newPw
+	entry.LastVaultRotation = time.Now()
+
+	return setStaticRole(ctx, s, entry.Name, entry)
+}
+
+// rollbackStaticPasswordNow restores the previous password of a static role's user without
+// waiting for the periodic rollback, the WAL entry is kept for a later attempt if the
+// restoration fails. The caller must hold staticRolesMutex.
+func (b *backend) rollbackStaticPasswordNow(ctx context.Context, s logical.Storage, walID string) {
+	walEntry, err := framework.GetWAL(ctx, s, walID)
+	if err == nil && walEntry != nil {
+		var entry staticPasswordWAL
+		err = mapstructure.Decode(walEntry.Data, &entry)
+		if err == nil {
+			err = b.rollbackStaticPassword(ctx, s, &entry)
+		}
+	}
+	if err == nil {
+		err = framework.DeleteWAL(ctx, s, walID)
+	}
+	if err != nil {
+		b.Logger().Error("could not roll back static role password rotation, will retry later", "wal_id", walID, "error", err)
+	}
+}
+
+// rotateDueStaticRoles rotates the passwords of all static roles whose rotation period has elapsed,
+// each role is locked only while it is rotated so that the static creds reads are not held by the sweep
+func (b *backend) rotateDueStaticRoles(ctx context.Context, req *logical.Request) error {
+	b.staticRolesMutex.RLock()
+	names, err := req.Storage.List(ctx, staticRolesPath)
+	b.staticRolesMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := b.rotateStaticRoleIfDue(ctx, req.Storage, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotateStaticRoleIfDue rotates the password of the static role if its rotation period has elapsed
+func (b *backend) rotateStaticRoleIfDue(ctx context.Context, s logical.Storage, name string) error {
+	b.staticRolesMutex.Lock()
+	defer b.staticRolesMutex.Unlock()
+
+	// the role may have been rotated, updated or deleted since it was listed
+	entry, err := getStaticRole(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if entry == nil || time.Now().Before(entry.nextRotation()) {
+		return nil
+	}
+
+	if err := b.rotateStaticRole(ctx, s, entry); err != nil {
+		// keep going, the role will be retried on the next tick
+		b.Logger().Error("could not rotate static role", "role", name, "user_id", entry.UserID, "error", err)
+	}
+
+	return nil
+}
+
+// setStaticRole adds the static role to the Vault storage API
+func setStaticRole(ctx context.Context, s logical.Storage, name string, roleEntry *nxrStaticRoleEntry) error {
+	entry, err := logical.StorageEntryJSON(staticRolesPath+name, roleEntry)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return fmt.Errorf("failed to create storage entry for static role")
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// getStaticRole gets the static role from the Vault storage API
+func getStaticRole(ctx context.Context, s logical.Storage, name string) (*nxrStaticRoleEntry, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing role name")
+	}
+
+	entry, err := s.Get(ctx, staticRolesPath+name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role nxrStaticRoleEntry
+
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+const (
+	pathStaticRolesHelpSynopsis    = `Manage the static roles bound to existing Nexus Repository users.`
+	pathStaticRolesHelpDescription = `
+This path lets you manage the static roles of this secrets engine.
+A static role binds a Vault role to an existing Nexus Repository user ("user_id"),
+Vault takes over the user's password and rotates it every "rotation_period".
+With the "user_token" or "nuget_api_key" "credential_type", the user's token
+or NuGet API key is reset on each rotation.
+`
+	pathStaticRolesListHelpSynopsis    = `List the existing static roles in this secrets engine.`
+	pathStaticRolesListHelpDescription = `A list of existing static role names will be returned.`
+)
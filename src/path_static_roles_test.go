@@ -0,0 +1,241 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	testStaticRoleName   = "test-static-role"
+	testStaticRoleUserID = "ci-builder"
+)
+
+func Test_StaticRoles(t *testing.T) {
+	t.Run("StaticRoles_SimpleCRUD", testStaticRoles_SimpleCRUD)
+	t.Run("StaticRoles_Create_Fail", testStaticRoles_Create_Fail)
+	t.Run("StaticRoles_PeriodicRotation", testStaticRoles_PeriodicRotation)
+	t.Run("StaticRoles_WALRollback_WithMockApi", testStaticRoles_WALRollback_WithMockApi)
+}
+
+func testStaticRoles_SimpleCRUD(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID)).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Create static role, the password is rotated immediately
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id":         testStaticRoleUserID,
+		"rotation_period": "1h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// List static roles
+	resp, err = doAction(actionList, staticRolesPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, []string{testStaticRoleName}, resp.Data["keys"])
+
+	// Read static role, the password must not be exposed
+	resp, err = doAction(actionRead, staticRolesPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testStaticRoleName, resp.Data["name"])
+	assert.Equal(t, testStaticRoleUserID, resp.Data["user_id"])
+	assert.Equal(t, float64(3600), resp.Data["rotation_period"])
+	assert.NotContains(t, resp.Data, "password")
+
+	// Update rotation period only, no rotation is expected
+	resp, err = doAction(actionUpdate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"rotation_period": "2h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, staticRolesPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(7200), resp.Data["rotation_period"])
+
+	// Delete static role
+	resp, err = doAction(actionDelete, staticRolesPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, staticRolesPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testStaticRoles_Create_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// Missing admin config
+	resp, err := doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id": testStaticRoleUserID,
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, "admin configuration not found", resp.Error().Error())
+
+	resp, err = initBaseAdminConfig(b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	testCases := []struct {
+		data          *testData // test input data
+		expectedError string    // expected error message
+	}{
+		{
+			data:          &testData{},
+			expectedError: `missing "user_id" in static role definition`,
+		},
+		{
+			data: &testData{
+				"user_id": testConfigAdminUsername,
+			},
+			expectedError: `"user_id" cannot be the admin user of the connection`,
+		},
+		{
+			data: &testData{
+				"user_id":         testStaticRoleUserID,
+				"rotation_period": "10s",
+			},
+			expectedError: `"rotation_period" must be at least 1m0s`,
+		},
+	}
+
+	for _, tc := range testCases {
+		resp, err := doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, *tc.data)
+
+		require.NoError(t, err)
+		assert.NotNil(t, resp)
+		assert.True(t, resp.IsError())
+		assert.Equal(t, tc.expectedError, resp.Error().Error())
+	}
+}
+
+func testStaticRoles_PeriodicRotation(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID)).
+			ReturnCode(httpmock.StatusOK).
+			Twice()
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id": testStaticRoleUserID,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	ctx := context.Background()
+	entry, err := getStaticRole(ctx, reqStorage, testStaticRoleName)
+	require.NoError(t, err)
+	oldPassword := entry.Password
+
+	// Not due yet, nothing to rotate
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: reqStorage}))
+
+	entry, err = getStaticRole(ctx, reqStorage, testStaticRoleName)
+	require.NoError(t, err)
+	assert.Equal(t, oldPassword, entry.Password)
+
+	// Pretend the rotation period has elapsed
+	entry.LastVaultRotation = time.Now().Add(-entry.RotationPeriod)
+	require.NoError(t, setStaticRole(ctx, reqStorage, testStaticRoleName, entry))
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: reqStorage}))
+
+	entry, err = getStaticRole(ctx, reqStorage, testStaticRoleName)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldPassword, entry.Password)
+	assert.WithinDuration(t, time.Now(), entry.LastVaultRotation, time.Minute)
+}
+
+func testStaticRoles_WALRollback_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID)).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id": testStaticRoleUserID,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	ctx := context.Background()
+	entry, err := getStaticRole(ctx, reqStorage, testStaticRoleName)
+	require.NoError(t, err)
+
+	// Simulate a rotation that changed the password on Nexus Repository but was never persisted,
+	// the stored password is restored
+	mockSrv.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID)).
+		WithBody(entry.Password).
+		ReturnCode(httpmock.StatusOK)
+
+	_, err = framework.PutWAL(ctx, reqStorage, staticPasswordWALKind, &staticPasswordWAL{
+		RoleName:    testStaticRoleName,
+		UserID:      testStaticRoleUserID,
+		OldPassword: entry.Password,
+	})
+	require.NoError(t, err)
+
+	// A rotation whose new password was persisted is left untouched
+	_, err = framework.PutWAL(ctx, reqStorage, staticPasswordWALKind, &staticPasswordWAL{
+		RoleName:    testStaticRoleName,
+		UserID:      testStaticRoleUserID,
+		OldPassword: "previous-password",
+	})
+	require.NoError(t, err)
+
+	resp, err = doAction(logical.RollbackOperation, "", b, reqStorage, testData{"immediate": true})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	walIDs, err := framework.ListWAL(ctx, reqStorage)
+	require.NoError(t, err)
+	assert.Empty(t, walIDs)
+}
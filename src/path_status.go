@@ -0,0 +1,157 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	statusPath     = "status"
+	statusEndpoint = client.BasePath + "v1/status"
+)
+
+// serverHeaderRegex matches the Server header of Nexus Repository, e.g. `Nexus/3.68.1-02 (PRO)`
+var serverHeaderRegex = regexp.MustCompile(`^Nexus/(\S+) \((\w+)\)`)
+
+// serverInfo is the version and edition of Nexus Repository
+type serverInfo struct {
+	Version string
+	Edition string
+}
+
+// parseServerHeader returns the server info of the Server header, nil if it is not set
+// (e.g. disabled on Nexus Repository, or removed by a reverse proxy)
+func parseServerHeader(header string) *serverInfo {
+	m := serverHeaderRegex.FindStringSubmatch(header)
+	if m == nil {
+		return nil
+	}
+
+	return &serverInfo{Version: m[1], Edition: strings.ToLower(m[2])}
+}
+
+// status checks that Nexus Repository can serve read requests and returns its server info
+func (c *nxrClient) status() (*serverInfo, error) {
+	body, resp, err := c.get(statusEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return parseServerHeader(resp.Header.Get("Server")), nil
+}
+
+// pathStatus extends the Vault API with a `status` endpoint for the backend.
+func pathStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: statusPath,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStatusRead,
+				Summary:  "Check the connection with Nexus Repository.",
+			},
+		},
+		HelpSynopsis:    pathStatusHelpSynopsis,
+		HelpDescription: pathStatusHelpDescription,
+	}
+}
+
+// pathConnectionStatus extends the Vault API with a `status/<name>` endpoint
+// checking a named connection, as `status` does for the one of `config/admin`.
+func pathConnectionStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: statusPath + "/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeNameString,
+				Description: "Name of the connection.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStatusRead,
+				Summary:  "Check a named connection with Nexus Repository.",
+			},
+		},
+		HelpSynopsis:    pathStatusHelpSynopsis,
+		HelpDescription: pathStatusHelpDescription,
+	}
+}
+
+// pathStatusRead probes Nexus Repository with the admin configuration of the connection and reports its health
+func (b *backend) pathStatusRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	connection := connectionName(data)
+	config, err := b.fetchAdminConfig(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return adminConfigNotFound(connection), nil
+	}
+
+	respData := map[string]interface{}{
+		"reachable":     false,
+		"authenticated": false,
+	}
+
+	// before the probe, which is an API call itself
+	if last := b.lastAPICall(connection).Load(); last != 0 {
+		respData["last_api_call"] = time.Unix(0, last)
+	}
+
+	if !config.LastRotated.IsZero() {
+		respData["last_rotated"] = config.LastRotated
+	}
+
+	c, err := b.getClient(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.status()
+	if err != nil {
+		respData["errors"] = []string{fmt.Sprintf("Nexus Repository is not reachable at '%s': %s", config.URL, err)}
+		return &logical.Response{Data: respData}, nil
+	}
+
+	respData["reachable"] = true
+	if info != nil {
+		respData["version"] = info.Version
+		respData["edition"] = info.Edition
+	}
+
+	if err := c.authenticate(config.Username); err != nil {
+		respData["errors"] = []string{fmt.Sprintf("could not authenticate as user '%s': %s", config.Username, err)}
+		return &logical.Response{Data: respData}, nil
+	}
+
+	respData["authenticated"] = true
+
+	return &logical.Response{Data: respData}, nil
+}
+
+const (
+	pathStatusHelpSynopsis = `Check the connection with Nexus Repository.`
+
+	pathStatusHelpDescription = `
+This endpoint probes Nexus Repository with the admin configuration, without
+issuing any credential. It reports whether Nexus Repository is reachable, its
+version and edition ("oss" or "pro"), and whether the admin credential still
+authenticates, along with the time of the last successful API call (since the
+plugin started on this Vault node) and of the last admin credential rotation.
+
+The connection of "config/admin" is probed, or a named connection with
+"status/<name>".
+`
+)
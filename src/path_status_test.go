@@ -0,0 +1,135 @@
+package nxr
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+func Test_Status(t *testing.T) {
+	t.Run("Status_WithMockApi", testStatus_WithMockApi)
+	t.Run("Status_WithMockApi_Fail", testStatus_WithMockApi_Fail)
+	t.Run("Status_ServerHeader", testStatus_ServerHeader)
+}
+
+func testStatus_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectGet(statusURI).
+			ReturnHeader("Server", "Nexus/3.68.1-02 (PRO)")
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnJSON([]string{})
+		s.ExpectGet(statusURI).
+			ReturnHeader("Server", "Nexus/3.68.1-02 (OSS)")
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusForbidden)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, statusPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, true, resp.Data["reachable"])
+	assert.Equal(t, true, resp.Data["authenticated"])
+	assert.Equal(t, "3.68.1-02", resp.Data["version"])
+	assert.Equal(t, "pro", resp.Data["edition"])
+	assert.NotContains(t, resp.Data, "errors")
+	assert.NotContains(t, resp.Data, "last_api_call")
+	assert.NotContains(t, resp.Data, "last_rotated")
+
+	// The previous probe is the last successful API call, a forbidden lookup still authenticates
+	resp, err = doAction(actionRead, statusPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, true, resp.Data["authenticated"])
+	assert.Equal(t, "oss", resp.Data["edition"])
+	assert.WithinDuration(t, time.Now(), resp.Data["last_api_call"].(time.Time), time.Minute)
+}
+
+func testStatus_WithMockApi_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// No admin configuration
+	resp, err := doAction(actionRead, statusPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, "admin configuration not found", resp.Error().Error())
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectGet(statusURI).
+			ReturnCode(httpmock.StatusServiceUnavailable)
+		s.ExpectGet(statusURI)
+		s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+			ReturnCode(httpmock.StatusUnauthorized)
+	})(t)
+
+	resp, err = doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Unreachable
+	resp, err = doAction(actionRead, statusPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, false, resp.Data["reachable"])
+	assert.Equal(t, false, resp.Data["authenticated"])
+	assert.NotContains(t, resp.Data, "version")
+	require.Len(t, resp.Data["errors"], 1)
+	assert.Contains(t, resp.Data["errors"].([]string)[0], fmt.Sprintf("Nexus Repository is not reachable at '%s': HTTP: 503", mockSrv.URL()))
+
+	// Wrong password, without Server header
+	resp, err = doAction(actionRead, statusPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, true, resp.Data["reachable"])
+	assert.Equal(t, false, resp.Data["authenticated"])
+	assert.NotContains(t, resp.Data, "version")
+	assert.NotContains(t, resp.Data, "edition")
+	require.Len(t, resp.Data["errors"], 1)
+	assert.Contains(t, resp.Data["errors"].([]string)[0], "could not authenticate as user 'admin': HTTP: 401")
+}
+
+func testStatus_ServerHeader(t *testing.T) {
+	testCases := []struct {
+		header   string
+		expected *serverInfo
+	}{
+		{
+			header:   "Nexus/3.68.1-02 (PRO)",
+			expected: &serverInfo{Version: "3.68.1-02", Edition: "pro"},
+		},
+		{
+			header:   "Nexus/3.41.0-01 (OSS)",
+			expected: &serverInfo{Version: "3.41.0-01", Edition: "oss"},
+		},
+		{
+			header: "nginx",
+		},
+		{
+			header: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, parseServerHeader(tc.header), tc.header)
+	}
+}
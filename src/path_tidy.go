@@ -0,0 +1,412 @@
+package nxr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	tidyPath        = "tidy"
+	tidyOrphansPath = "tidy/orphans/"
+)
+
+// orphanedUser records when a user matching the prefix, but not
+// recorded by this secrets engine, was first found on Nexus Repository
+type orphanedUser struct {
+	UserID     string    `json:"user_id"`
+	Connection string    `json:"connection,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+}
+
+// tidyReport lists the users handled by a tidy operation
+type tidyReport struct {
+	Deleted []string
+	Pending []string
+	Failed  []string
+}
+
+// toResponseData returns response data for a tidy report
+func (r *tidyReport) toResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"deleted_users": r.Deleted,
+		"pending_users": r.Pending,
+		"failed_users":  r.Failed,
+	}
+}
+
+// pathTidy extends the Vault API with a `tidy`
+// endpoint for the backend.
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: tidyPath,
+		Fields: map[string]*framework.FieldSchema{
+			"user_id_prefix": {
+				Type:        framework.TypeString,
+				Description: userIDPrefixHelp + " Overrides the tidy configuration.",
+			},
+			"safety_buffer": {
+				Type:        framework.TypeDurationSecond,
+				Description: safetyBufferHelp + " Overrides the tidy configuration.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTidyWrite,
+				Summary:  "Delete the orphaned Nexus Repository users.",
+			},
+		},
+		HelpSynopsis:    pathTidyHelpSynopsis,
+		HelpDescription: pathTidyHelpDescription,
+	}
+}
+
+// pathTidyWrite tidies the orphaned users and reports what was done
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	config, err := fetchTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDPrefix := config.UserIDPrefix
+	if userIDPrefixRaw, ok := data.GetOk("user_id_prefix"); ok {
+		userIDPrefix = userIDPrefixRaw.(string)
+	}
+
+	safetyBuffer := config.SafetyBuffer
+	if safetyBufferRaw, ok := data.GetOk("safety_buffer"); ok {
+		safetyBuffer = time.Duration(safetyBufferRaw.(int)) * time.Second
+	}
+
+	if userIDPrefix == "" {
+		return logical.ErrorResponse(`"user_id_prefix" cannot be empty`), nil
+	}
+	if safetyBuffer < 0 {
+		return logical.ErrorResponse(`"safety_buffer" cannot be negative`), nil
+	}
+
+	report, err := b.tidyOrphanedUsers(ctx, req.Storage, userIDPrefix, safetyBuffer)
+	if err != nil {
+		return logical.ErrorResponse("could not tidy Nexus Repository users"), err
+	}
+
+	config.LastTidy = time.Now()
+	if err := setTidyConfig(ctx, req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: report.toResponseData(),
+	}, nil
+}
+
+// tidyIfDue tidies the orphaned users when the periodic tidy
+// is enabled and its interval has elapsed since the last tidy
+func (b *backend) tidyIfDue(ctx context.Context, s logical.Storage) error {
+	b.tidyMutex.Lock()
+	defer b.tidyMutex.Unlock()
+
+	config, err := fetchTidyConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+	if !config.PeriodicTidy || time.Now().Before(config.LastTidy.Add(config.TidyInterval)) {
+		return nil
+	}
+	// a configuration written before the prefix was required would list every user
+	if config.UserIDPrefix == "" {
+		return errors.New(`"user_id_prefix" is not configured`)
+	}
+
+	report, err := b.tidyOrphanedUsers(ctx, s, config.UserIDPrefix, config.SafetyBuffer)
+	if err != nil {
+		return err
+	}
+	if len(report.Deleted) > 0 || len(report.Failed) > 0 {
+		b.Logger().Info("tidied orphaned users", "deleted", report.Deleted, "failed", report.Failed)
+	}
+
+	config.LastTidy = time.Now()
+	return setTidyConfig(ctx, s, config)
+}
+
+// tidyOrphanedUsers deletes the users matching the prefix on the Nexus Repository of each connection
+// which are left behind by this secrets engine. A user recorded as issued is deleted once its lease has
+// expired for longer than the safety buffer, a user which is not recorded (e.g. issued before the records
+// were kept) once it has been found for longer than the max lease TTL plus the safety buffer, as no lease
+// can outlive it. The admin users, the static roles' users and the disabled users are never deleted.
+// The caller must hold tidyMutex.
+func (b *backend) tidyOrphanedUsers(ctx context.Context, s logical.Storage, userIDPrefix string, safetyBuffer time.Duration) (*tidyReport, error) {
+	connections, err := listConnections(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	// list the users before looking up the known ones, so a user being
+	// created meanwhile is already covered by its WAL entry or record
+	users := map[string][]string{}
+	for _, connection := range connections {
+		config, err := b.fetchAdminConfig(ctx, s, connection)
+		if err != nil {
+			return nil, err
+		}
+		// config/admin is not required when only named connections are used
+		if config == nil {
+			continue
+		}
+
+		client, err := b.getClient(ctx, s, connection)
+		if err != nil {
+			return nil, err
+		}
+
+		connectionUsers, err := client.listUsers(userIDPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the users of connection %q: %w", connection, err)
+		}
+		for _, user := range connectionUsers {
+			users[connection] = append(users[connection], user.UserID)
+		}
+	}
+
+	issuedUsers, err := listIssuedUsers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	knownUserIDs, err := b.knownUserIDs(ctx, s, connections)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &tidyReport{Deleted: []string{}, Pending: []string{}, Failed: []string{}}
+	orphanUserIDs := map[string]bool{}
+	now := time.Now()
+	for _, connection := range connections {
+		for _, userID := range users[connection] {
+			var roleID string
+			issued, ok := issuedUsers[userID]
+			switch {
+			case ok && issued.Connection == connection:
+				if now.Before(issued.LeaseExpiry) {
+					continue
+				}
+				if now.Before(issued.LeaseExpiry.Add(safetyBuffer)) {
+					report.Pending = append(report.Pending, userID)
+					continue
+				}
+				roleID = issued.EphemeralRoleID
+			case ok || knownUserIDs[userID]:
+				continue
+			default:
+				orphanUserIDs[userID] = true
+				orphan, err := getOrphanedUser(ctx, s, userID)
+				if err != nil {
+					return nil, err
+				}
+				if orphan == nil || orphan.Connection != connection {
+					orphan = &orphanedUser{UserID: userID, Connection: connection, FirstSeen: now}
+					if err := setOrphanedUser(ctx, s, orphan); err != nil {
+						return nil, err
+					}
+				}
+				if now.Before(orphan.FirstSeen.Add(b.System().MaxLeaseTTL() + safetyBuffer)) {
+					report.Pending = append(report.Pending, userID)
+					continue
+				}
+				// the dedicated role of a user has the user's ID
+				roleID = userID
+			}
+
+			client, err := b.getClient(ctx, s, connection)
+			if err == nil {
+				err = deleteUserAndRole(ctx, client, userID, roleID)
+			}
+			if err != nil {
+				// keep going, the user will be retried on the next tidy
+				b.Logger().Error("could not delete orphaned user", "connection", connection, "user_id", userID, "error", err)
+				report.Failed = append(report.Failed, userID)
+				continue
+			}
+			report.Deleted = append(report.Deleted, userID)
+
+			if ok {
+				err = deleteIssuedUser(ctx, s, issued.RoleName, userID)
+			} else {
+				err = s.Delete(ctx, tidyOrphansPath+userID)
+				delete(orphanUserIDs, userID)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// forget the users which are gone or known again
+	recordedUserIDs, err := s.List(ctx, tidyOrphansPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range recordedUserIDs {
+		if !orphanUserIDs[userID] {
+			if err := s.Delete(ctx, tidyOrphansPath+userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// listIssuedUsers returns the users issued by the roles of this secrets engine, by user ID
+func listIssuedUsers(ctx context.Context, s logical.Storage) (map[string]*issuedUser, error) {
+	roleNames, err := s.List(ctx, issuedUsersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	issuedUsers := map[string]*issuedUser{}
+	for _, roleName := range roleNames {
+		roleName = strings.TrimSuffix(roleName, "/")
+		userIDs, err := s.List(ctx, issuedUsersPath+roleName+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, userID := range userIDs {
+			issued, err := getIssuedUser(ctx, s, roleName, userID)
+			if err != nil {
+				return nil, err
+			}
+			if issued != nil {
+				issuedUsers[userID] = issued
+			}
+		}
+	}
+
+	return issuedUsers, nil
+}
+
+// knownUserIDs returns the IDs of the other Nexus Repository users managed by this secrets engine,
+// on any of the connections: the users being created, the admin users (current and previous),
+// the disabled users and the static roles' users
+func (b *backend) knownUserIDs(ctx context.Context, s logical.Storage, connections []string) (map[string]bool, error) {
+	userIDs := map[string]bool{}
+
+	walIDs, err := framework.ListWAL(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, walID := range walIDs {
+		wal, err := framework.GetWAL(ctx, s, walID)
+		if err != nil {
+			return nil, err
+		}
+		if wal == nil || wal.Kind != userCreationWALKind {
+			continue
+		}
+
+		var entry userCreationWAL
+		if err := mapstructure.Decode(wal.Data, &entry); err != nil {
+			return nil, err
+		}
+		userIDs[entry.UserID] = true
+	}
+
+	for _, connection := range connections {
+		config, err := b.fetchAdminConfig(ctx, s, connection)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			userIDs[config.Username] = true
+		}
+	}
+
+	for _, path := range []string{retiredAdminsPath, disabledUsersPath} {
+		listed, err := s.List(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range listed {
+			userIDs[userID] = true
+		}
+	}
+
+	staticRoleNames, err := s.List(ctx, staticRolesPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range staticRoleNames {
+		staticRole, err := getStaticRole(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if staticRole != nil {
+			userIDs[staticRole.UserID] = true
+		}
+	}
+
+	return userIDs, nil
+}
+
+// getOrphanedUser gets the orphaned user from the Vault storage API
+func getOrphanedUser(ctx context.Context, s logical.Storage, userID string) (*orphanedUser, error) {
+	entry, err := s.Get(ctx, tidyOrphansPath+userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var orphan orphanedUser
+	if err := entry.DecodeJSON(&orphan); err != nil {
+		return nil, err
+	}
+	return &orphan, nil
+}
+
+// setOrphanedUser adds the orphaned user to the Vault storage API
+func setOrphanedUser(ctx context.Context, s logical.Storage, orphan *orphanedUser) error {
+	entry, err := logical.StorageEntryJSON(tidyOrphansPath+orphan.UserID, orphan)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+const (
+	pathTidyHelpSynopsis = `Delete the Nexus Repository users left behind by this secrets engine.`
+
+	pathTidyHelpDescription = `
+This endpoint lists the users matching "user_id_prefix" on the Nexus Repository
+of each connection, those left behind by this secrets engine (e.g. their
+revocation failed, or their lease was force-revoked) are orphaned and deleted
+(with their dedicated role) by this or a later tidy operation:
+
+- a user issued by a role is deleted once its lease has expired for longer
+  than "safety_buffer".
+- a user which was not recorded as issued (e.g. issued before the records
+  were kept) is deleted once it has been found for longer than the max lease
+  TTL plus "safety_buffer", as its lease cannot outlive the max lease TTL.
+
+The admin users, the static roles' users and the users disabled on revoke are
+never deleted. The prefix must be unique to this secrets engine, the users
+of another mount sharing it would be deleted.
+
+The deleted users, the users waiting for the safety buffer to elapse
+and the users which could not be deleted are reported.
+`
+)
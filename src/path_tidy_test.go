@@ -0,0 +1,225 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	testTidyUserIDPrefix  = "v-"
+	testOrphanUser        = "v-orphan"
+	testExpiredOrphanUser = "v-expired-orphan"
+	testUnrecordedUser    = "v-unrecorded"
+	testTidyDisabledUser  = "v-disabled"
+	usersListURI          = "/service/rest/v1/security/users?source=default&userId=%s"
+)
+
+func Test_Tidy(t *testing.T) {
+	t.Run("ConfigTidy", testConfigTidy)
+	t.Run("Tidy_WithMockApi", testTidy_WithMockApi)
+}
+
+func testConfigTidy(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// Defaults
+	resp, err := doAction(actionRead, configTidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", resp.Data["user_id_prefix"])
+	assert.Equal(t, false, resp.Data["periodic_tidy"])
+	assert.Equal(t, int64(defaultTidyInterval), resp.Data["tidy_interval"])
+	assert.Equal(t, int64(defaultSafetyBuffer), resp.Data["safety_buffer"])
+
+	// The periodic tidy needs the prefix of the users
+	resp, err = doAction(actionUpdate, configTidyPath, b, reqStorage, testData{
+		"periodic_tidy": true,
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"user_id_prefix" is required when "periodic_tidy" is enabled`, resp.Error().Error())
+
+	resp, err = doAction(actionUpdate, configTidyPath, b, reqStorage, testData{
+		"user_id_prefix": testTidyUserIDPrefix,
+		"periodic_tidy":  true,
+		"tidy_interval":  "1h",
+		"safety_buffer":  "2h",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, configTidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testTidyUserIDPrefix, resp.Data["user_id_prefix"])
+	assert.Equal(t, true, resp.Data["periodic_tidy"])
+	assert.Equal(t, int64(3600), resp.Data["tidy_interval"])
+	assert.Equal(t, int64(7200), resp.Data["safety_buffer"])
+
+	testCases := []struct {
+		data          testData
+		expectedError string
+	}{
+		{
+			data:          testData{"tidy_interval": "10s"},
+			expectedError: `"tidy_interval" must be at least 1m0s`,
+		},
+	}
+
+	for _, tc := range testCases {
+		resp, err := doAction(actionUpdate, configTidyPath, b, reqStorage, tc.data)
+		require.NoError(t, err)
+		assert.True(t, resp.IsError())
+		assert.Equal(t, tc.expectedError, resp.Error().Error())
+	}
+
+	// A negative safety buffer is rejected
+	resp, err = doAction(actionUpdate, configTidyPath, b, reqStorage, testData{
+		"safety_buffer": "-1h",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "negative")
+}
+
+func testTidy_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI).
+			ReturnCode(httpmock.StatusOK)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The prefix of the users is required, and the safety buffer cannot be negative
+	resp, err = doAction(actionUpdate, tidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"user_id_prefix" cannot be empty`, resp.Error().Error())
+
+	resp, err = doAction(actionUpdate, tidyPath, b, reqStorage, testData{
+		"user_id_prefix": testTidyUserIDPrefix,
+		"safety_buffer":  "-1h",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "negative")
+
+	resp, err = doAction(actionUpdate, configTidyPath, b, reqStorage, testData{
+		"user_id_prefix": testTidyUserIDPrefix,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The user of a live lease is never tidied
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	liveUser := resp.Data["user_id"].(string)
+
+	// Simulate users whose lease was force-revoked
+	ctx := context.Background()
+	for userID, leaseExpiry := range map[string]time.Time{
+		testOrphanUser:        time.Now().Add(-time.Hour),
+		testExpiredOrphanUser: time.Now().Add(-defaultSafetyBuffer*time.Second - time.Hour),
+	} {
+		err = setIssuedUser(ctx, reqStorage, &issuedUser{
+			UserID:      userID,
+			RoleName:    testRoleName,
+			LeaseExpiry: leaseExpiry,
+		})
+		require.NoError(t, err)
+	}
+
+	// The disabled users are kept
+	require.NoError(t, setDisabledUser(ctx, reqStorage, &disabledUser{UserID: testTidyDisabledUser}))
+
+	// The orphaned user is kept during the safety buffer, the user not recorded
+	// as issued is kept until its lease could have expired. The search of Nexus
+	// Repository is not anchored, the users not starting with the prefix are kept
+	mockSrv.ExpectGet(fmt.Sprintf(usersListURI, testTidyUserIDPrefix)).
+		ReturnJSON([]security.User{
+			{UserID: liveUser},
+			{UserID: testOrphanUser},
+			{UserID: testExpiredOrphanUser},
+			{UserID: testUnrecordedUser},
+			{UserID: testTidyDisabledUser},
+			{UserID: "x-" + testUnrecordedUser},
+		})
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, testExpiredOrphanUser))
+
+	resp, err = doAction(actionUpdate, tidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, []string{testExpiredOrphanUser}, resp.Data["deleted_users"])
+	assert.ElementsMatch(t, []string{testOrphanUser, testUnrecordedUser}, resp.Data["pending_users"])
+
+	orphan, err := getOrphanedUser(ctx, reqStorage, testUnrecordedUser)
+	require.NoError(t, err)
+	require.NotNil(t, orphan)
+	assert.WithinDuration(t, time.Now(), orphan.FirstSeen, time.Minute)
+
+	// The orphaned user is deleted once the safety buffer has elapsed
+	mockSrv.ExpectGet(fmt.Sprintf(usersListURI, testTidyUserIDPrefix)).
+		ReturnJSON([]security.User{{UserID: liveUser}, {UserID: testOrphanUser}, {UserID: testUnrecordedUser}})
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, testOrphanUser))
+
+	resp, err = doAction(actionUpdate, tidyPath, b, reqStorage, testData{
+		"safety_buffer": 0,
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, []string{testOrphanUser}, resp.Data["deleted_users"])
+	assert.Equal(t, []string{testUnrecordedUser}, resp.Data["pending_users"])
+	assert.Equal(t, []string{}, resp.Data["failed_users"])
+
+	// The user not recorded as issued is deleted, with its dedicated
+	// role, once the max lease TTL and the safety buffer have elapsed
+	orphan.FirstSeen = time.Now().Add(-b.System().MaxLeaseTTL() - defaultSafetyBuffer*time.Second - time.Minute)
+	require.NoError(t, setOrphanedUser(ctx, reqStorage, orphan))
+	mockSrv.ExpectGet(fmt.Sprintf(usersListURI, testTidyUserIDPrefix)).
+		ReturnJSON([]security.User{{UserID: liveUser}, {UserID: testUnrecordedUser}})
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, testUnrecordedUser))
+	mockSrv.ExpectDelete(fmt.Sprintf(roleURI, testUnrecordedUser)).
+		ReturnCode(httpmock.StatusNotFound)
+
+	resp, err = doAction(actionUpdate, tidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, []string{testUnrecordedUser}, resp.Data["deleted_users"])
+	assert.Equal(t, []string{}, resp.Data["pending_users"])
+
+	orphan, err = getOrphanedUser(ctx, reqStorage, testUnrecordedUser)
+	require.NoError(t, err)
+	assert.Nil(t, orphan)
+
+	// Only the user of the live lease is still recorded
+	resp, err = doAction(actionList, issuedUsersPath+testRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Len(t, resp.Data["keys"], 1)
+
+	// Tidy is recorded
+	resp, err = doAction(actionRead, configTidyPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, resp.Data["last_tidy"])
+}
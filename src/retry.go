@@ -0,0 +1,59 @@
+package nxr
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Retries of the Nexus Repository API calls failing with a transient error,
+// the delay doubles on each attempt and is jittered to spread concurrent retries
+var (
+	retryMaxAttempts = 4
+	retryBaseDelay   = 500 * time.Millisecond
+	retryMaxDelay    = 5 * time.Second
+)
+
+// isNotFound returns true if Nexus Repository responded that the resource does not exist
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isTransient returns true if the call may succeed when retried: a server
+// side error, a rate limiting or no response at all (e.g. connection error)
+func isTransient(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// withRetry calls op until it succeeds, fails with a non transient error or the attempts are exhausted
+func withRetry(ctx context.Context, op func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !isTransient(err) || attempt >= retryMaxAttempts {
+			return err
+		}
+
+		// full jitter on the upper half of the delay
+		jittered := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jittered):
+		}
+
+		delay = min(2*delay, retryMaxDelay)
+	}
+}
@@ -0,0 +1,186 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	revocationModeDelete            = "delete"
+	revocationModeDisable           = "disable"
+	revocationModeDisableThenDelete = "disable_then_delete"
+	disabledUsersPath               = "disabled/"
+	defaultDisabledUserRetention    = 30 * 24 * 60 * 60 // 30 days in seconds
+)
+
+// disabledUser records a Nexus Repository user disabled on revoke, it is
+// purged (with its dedicated role) once PurgeAt is passed, if it is set
+type disabledUser struct {
+	UserID          string    `json:"user_id"`
+	RoleName        string    `json:"role_name"`
+	EphemeralRoleID string    `json:"ephemeral_role_id,omitempty"`
+	Connection      string    `json:"connection,omitempty"`
+	DisabledAt      time.Time `json:"disabled_at"`
+	PurgeAt         time.Time `json:"purge_at,omitempty"`
+}
+
+// deleteUserAndRole deletes the user and its dedicated role, if any,
+// a user or role already deleted is ignored
+func deleteUserAndRole(ctx context.Context, client *nxrClient, userID string, roleID string) error {
+	err := withRetry(ctx, func() error { return client.deleteUser(userID) })
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if roleID != "" {
+		err = withRetry(ctx, func() error { return client.deleteRole(roleID) })
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// disableUser disables the user on Nexus Repository and records it,
+// to be purged once its PurgeAt is passed, if it is set
+func (b *backend) disableUser(ctx context.Context, s logical.Storage, client *nxrClient, credentialType string, disabled *disabledUser) error {
+	if err := b.revokeCredential(ctx, s, client, disabled.Connection, credentialType, disabled.UserID); err != nil {
+		return err
+	}
+
+	err := withRetry(ctx, func() error { return client.disableUser(disabled.UserID) })
+	if isNotFound(err) {
+		// nothing is left to audit
+		return deleteUserAndRole(ctx, client, disabled.UserID, disabled.EphemeralRoleID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return setDisabledUser(ctx, s, disabled)
+}
+
+// disabledUserRetention returns the retention of a user disabled in `disable_then_delete` mode,
+// the one of the role when the lease was issued
+func disabledUserRetention(internalData map[string]interface{}) (time.Duration, error) {
+	retentionRaw, ok := internalData["disabled_user_retention"]
+	if !ok {
+		return time.Duration(defaultDisabledUserRetention) * time.Second, nil
+	}
+
+	retention, err := time.ParseDuration(retentionRaw.(string))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the disabled user retention of the lease: %w", err)
+	}
+	return retention, nil
+}
+
+// revokeCredential invalidates the user token or deletes the NuGet API key of a user which is kept
+// disabled, a credential cannot be used by a disabled user but would be valid again if the user
+// was re-enabled
+func (b *backend) revokeCredential(ctx context.Context, s logical.Storage, client *nxrClient, connection string, credentialType string, userID string) error {
+	switch credentialType {
+	case credentialTypeUserToken:
+		// a missing user is deleted along with its token
+		err := withRetry(ctx, func() error { return client.resetUserToken(userID) })
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case credentialTypeNuGetAPIKey:
+		return b.revokeNuGetAPIKey(ctx, s, client, connection, userID)
+	default:
+		return nil
+	}
+}
+
+// revokeNuGetAPIKey deletes the NuGet API key of a user
+func (b *backend) revokeNuGetAPIKey(ctx context.Context, s logical.Storage, client *nxrClient, connection string, userID string) error {
+	user, err := client.getUser(userID)
+	if err != nil || user == nil {
+		// a missing user is deleted along with its key
+		return err
+	}
+
+	// the key can only be deleted by the user itself, with a password only known here
+	password, err := b.generatePassword(ctx, passwordConfig{})
+	if err != nil {
+		return err
+	}
+	if err := withRetry(ctx, func() error { return client.changeUserPassword(userID, password) }); err != nil {
+		return err
+	}
+
+	config, err := b.fetchAdminConfig(ctx, s, connection)
+	if err != nil {
+		return err
+	}
+	return withRetry(ctx, func() error { return deleteNuGetAPIKey(config, userID, password) })
+}
+
+// purgeDisabledUsers deletes the disabled users whose retention has elapsed
+func (b *backend) purgeDisabledUsers(ctx context.Context, s logical.Storage) error {
+	userIDs, err := s.List(ctx, disabledUsersPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		disabled, err := getDisabledUser(ctx, s, userID)
+		if err != nil {
+			return err
+		}
+		if disabled == nil || disabled.PurgeAt.IsZero() || now.Before(disabled.PurgeAt) {
+			continue
+		}
+
+		client, err := b.getClient(ctx, s, disabled.Connection)
+		if err == nil {
+			err = deleteUserAndRole(ctx, client, disabled.UserID, disabled.EphemeralRoleID)
+		}
+		if err != nil {
+			// keep going, the user will be retried on the next tick
+			b.Logger().Error("could not purge disabled user", "connection", disabled.Connection, "user_id", userID, "error", err)
+			continue
+		}
+
+		if err := s.Delete(ctx, disabledUsersPath+userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getDisabledUser gets the disabled user from the Vault storage API
+func getDisabledUser(ctx context.Context, s logical.Storage, userID string) (*disabledUser, error) {
+	entry, err := s.Get(ctx, disabledUsersPath+userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	var disabled disabledUser
+	if err := entry.DecodeJSON(&disabled); err != nil {
+		return nil, err
+	}
+	return &disabled, nil
+}
+
+// setDisabledUser adds the disabled user to the Vault storage API
+func setDisabledUser(ctx context.Context, s logical.Storage, disabled *disabledUser) error {
+	entry, err := logical.StorageEntryJSON(disabledUsersPath+disabled.UserID, disabled)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
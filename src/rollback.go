@@ -0,0 +1,188 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	walRollbackMinAge     = 10 * time.Minute
+	adminPasswordWALKind  = "adminPasswordRotation"
+	userCreationWALKind   = "userCreation"
+	staticPasswordWALKind = "staticPasswordRotation"
+)
+
+// adminPasswordWAL records an admin's password rotation in progress,
+// so the previous password can be restored if the rotation is not persisted
+type adminPasswordWAL struct {
+	Connection  string `json:"connection,omitempty" mapstructure:"connection"`
+	Username    string `json:"username" mapstructure:"username"`
+	OldPassword string `json:"old_password" mapstructure:"old_password"`
+	NewPassword string `json:"new_password" mapstructure:"new_password"`
+}
+
+// userCreationWAL records a user being created for a role,
+// so the user is deleted if its lease is not returned
+type userCreationWAL struct {
+	UserID          string `json:"user_id" mapstructure:"user_id"`
+	RoleName        string `json:"role_name" mapstructure:"role_name"`
+	Connection      string `json:"connection,omitempty" mapstructure:"connection"`
+	EphemeralRoleID string `json:"ephemeral_role_id" mapstructure:"ephemeral_role_id"`
+	CacheKey        string `json:"cache_key" mapstructure:"cache_key"`
+}
+
+// staticPasswordWAL records a static role's password rotation in progress,
+// so the previous password can be restored if the rotation is not persisted
+type staticPasswordWAL struct {
+	RoleName    string `json:"role_name" mapstructure:"role_name"`
+	Connection  string `json:"connection,omitempty" mapstructure:"connection"`
+	UserID      string `json:"user_id" mapstructure:"user_id"`
+	OldPassword string `json:"old_password" mapstructure:"old_password"`
+}
+
+// walRollback dispatches the rollback of a WAL entry to the handler of its kind
+func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case adminPasswordWALKind:
+		var entry adminPasswordWAL
+		if err := mapstructure.Decode(data, &entry); err != nil {
+			return err
+		}
+		b.rotationMutex.Lock()
+		defer b.rotationMutex.Unlock()
+		return b.rollbackAdminPassword(ctx, req.Storage, &entry)
+	case userCreationWALKind:
+		var entry userCreationWAL
+		if err := mapstructure.Decode(data, &entry); err != nil {
+			return err
+		}
+		b.cacheMutex.Lock()
+		defer b.cacheMutex.Unlock()
+		return b.rollbackUserCreation(ctx, req.Storage, &entry)
+	case staticPasswordWALKind:
+		var entry staticPasswordWAL
+		if err := mapstructure.Decode(data, &entry); err != nil {
+			return err
+		}
+		b.staticRolesMutex.Lock()
+		defer b.staticRolesMutex.Unlock()
+		return b.rollbackStaticPassword(ctx, req.Storage, &entry)
+	default:
+		return fmt.Errorf("unknown WAL entry kind %q", kind)
+	}
+}
+
+// rollbackAdminPassword ensures that the admin's password stored in the configuration
+// is the one accepted by Nexus Repository, by restoring the previous password if needed.
+// The caller must hold rotationMutex.
+func (b *backend) rollbackAdminPassword(ctx context.Context, s logical.Storage, entry *adminPasswordWAL) error {
+	config, err := b.fetchAdminConfig(ctx, s, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	// The new password has been persisted, or the configuration has been changed since
+	if config == nil || config.Username != entry.Username || config.Password != entry.OldPassword {
+		return nil
+	}
+
+	// The password was not changed on Nexus Repository
+	if err := verifyCredential(config); err == nil {
+		return nil
+	}
+
+	newConfig := *config
+	newConfig.Password = entry.NewPassword
+
+	c, err := newClient(&newConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := c.changeUserPassword(entry.Username, entry.OldPassword); err != nil {
+		return err
+	}
+
+	// reset the client in case it was built while the password was being changed
+	b.reset(entry.Connection)
+
+	return nil
+}
+
+// rollbackStaticPassword restores the previous password of a static role's user when the new
+// one was not persisted, the caller must hold staticRolesMutex
+func (b *backend) rollbackStaticPassword(ctx context.Context, s logical.Storage, entry *staticPasswordWAL) error {
+	role, err := getStaticRole(ctx, s, entry.RoleName)
+	if err != nil {
+		return err
+	}
+
+	// The new password has been persisted, or the static role has been changed since
+	if role == nil || role.UserID != entry.UserID || role.Connection != entry.Connection || role.Password != entry.OldPassword {
+		return nil
+	}
+
+	client, err := b.getClient(ctx, s, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	return client.changeUserPassword(entry.UserID, entry.OldPassword)
+}
+
+// rollbackUserCreation deletes the user (and its dedicated role) whose lease was not returned,
+// a cached user reused by another lease meanwhile is kept. The caller must hold cacheMutex.
+func (b *backend) rollbackUserCreation(ctx context.Context, s logical.Storage, entry *userCreationWAL) error {
+	if entry.CacheKey != "" {
+		inUse, err := releaseCachedUser(ctx, s, entry.CacheKey)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return nil
+		}
+	}
+
+	client, err := b.getClient(ctx, s, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	// the user (or role) was not created, or is already deleted
+	if err := client.deleteUser(entry.UserID); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if entry.EphemeralRoleID != "" {
+		if err := client.deleteRole(entry.EphemeralRoleID); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return deleteIssuedUser(ctx, s, entry.RoleName, entry.UserID)
+}
+
+// rollbackUserCreationNow rolls back the user creation of a failed creds request right away,
+// the WAL entry is left to the periodic rollback if it fails
+func (b *backend) rollbackUserCreationNow(ctx context.Context, s logical.Storage, walID string) {
+	walEntry, err := framework.GetWAL(ctx, s, walID)
+	if err == nil && walEntry != nil {
+		var entry userCreationWAL
+		err = mapstructure.Decode(walEntry.Data, &entry)
+		if err == nil {
+			// the caller already holds cacheMutex for a cached user
+			err = b.rollbackUserCreation(ctx, s, &entry)
+		}
+	}
+	if err == nil {
+		err = framework.DeleteWAL(ctx, s, walID)
+	}
+	if err != nil {
+		b.Logger().Error("could not roll back user creation, will retry later", "wal_id", walID, "error", err)
+	}
+}
@@ -0,0 +1,77 @@
+package nxr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultTLSMinVersion = "tls12"
+)
+
+// tlsVersions maps the tls_min_version values to the TLS versions
+var tlsVersions = map[string]uint16{
+	"tls10": tls.VersionTLS10,
+	"tls11": tls.VersionTLS11,
+	"tls12": tls.VersionTLS12,
+	"tls13": tls.VersionTLS13,
+}
+
+// tlsVersionNames returns the tls_min_version values, sorted
+func tlsVersionNames() []string {
+	names := make([]string, 0, len(tlsVersions))
+	for name := range tlsVersions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// tlsConfig builds the TLS configuration of the connection with Nexus Repository:
+// the CA certificate is trusted along with the system ones, and the client
+// certificate is presented to servers (or reverse proxies) requiring mTLS
+func (c *adminConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		ServerName:         c.TLSServerName,
+	}
+
+	minVersion := c.TLSMinVersion
+	if minVersion == "" {
+		minVersion = defaultTLSMinVersion
+	}
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf(`"tls_min_version" must be one of "%s"`, strings.Join(tlsVersionNames(), `", "`))
+	}
+	tlsConfig.MinVersion = version
+
+	if c.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New(`"ca_cert" does not contain any PEM certificate`)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return nil, errors.New(`"client_cert" and "client_key" must be set together`)
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf(`"client_cert" and "client_key" are not a valid PEM key pair: %w`, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
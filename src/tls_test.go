@@ -0,0 +1,186 @@
+package nxr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TLS(t *testing.T) {
+	t.Run("TLS_Config_Fail", testTLS_Config_Fail)
+	t.Run("TLS_MutualTLS", testTLS_MutualTLS)
+	t.Run("TLS_ConfigAdmin", testTLS_ConfigAdmin)
+}
+
+// generateTestClientCert generates a self-signed client certificate and its key, PEM encoded
+func generateTestClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return cert,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func testTLS_Config_Fail(t *testing.T) {
+	_, clientCert, clientKey := generateTestClientCert(t)
+
+	testCases := []struct {
+		config        adminConfig
+		expectedError string
+	}{
+		{
+			config:        adminConfig{TLSMinVersion: "ssl3"},
+			expectedError: `"tls_min_version" must be one of "tls10", "tls11", "tls12", "tls13"`,
+		},
+		{
+			config:        adminConfig{CACert: "not a certificate"},
+			expectedError: `"ca_cert" does not contain any PEM certificate`,
+		},
+		{
+			config:        adminConfig{ClientCert: clientCert},
+			expectedError: `"client_cert" and "client_key" must be set together`,
+		},
+		{
+			config:        adminConfig{ClientCert: clientCert, ClientKey: clientCert},
+			expectedError: `"client_cert" and "client_key" are not a valid PEM key pair: tls: found a certificate rather than a key in the PEM for the private key`,
+		},
+	}
+
+	for _, tc := range testCases {
+		_, err := tc.config.tlsConfig()
+		assert.EqualError(t, err, tc.expectedError)
+	}
+
+	tlsConfig, err := (&adminConfig{ClientCert: clientCert, ClientKey: clientKey}).tlsConfig()
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+}
+
+func testTLS_MutualTLS(t *testing.T) {
+	clientCert, clientCertPEM, clientKeyPEM := generateTestClientCert(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caCertPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	config := &adminConfig{
+		Username: testConfigAdminUsername,
+		Password: testConfigAdminPassword,
+		URL:      srv.URL,
+		Timeout:  5,
+	}
+
+	// The server certificate is not trusted
+	err := verifyCredential(config)
+	assert.ErrorContains(t, err, "certificate signed by unknown authority")
+
+	// The client certificate is required
+	config.CACert = caCertPEM
+	err = verifyCredential(config)
+	assert.Error(t, err)
+
+	config.ClientCert = clientCertPEM
+	config.ClientKey = clientKeyPEM
+	assert.NoError(t, verifyCredential(config))
+
+	// The server certificate is verified against the server name
+	config.TLSServerName = "nexus.example.org"
+	err = verifyCredential(config)
+	assert.ErrorContains(t, err, "nexus.example.org")
+
+	// The test certificate is issued for example.com
+	config.TLSServerName = "example.com"
+	assert.NoError(t, verifyCredential(config))
+}
+
+func testTLS_ConfigAdmin(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	_, clientCert, clientKey := generateTestClientCert(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"client_cert":       clientCert,
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"client_cert" and "client_key" must be set together`, resp.Error().Error())
+
+	resp, err = doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"client_cert":       clientCert,
+		"client_key":        clientKey,
+		"tls_server_name":   "nexus.example.org",
+		"tls_min_version":   "tls13",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, clientCert, resp.Data["client_cert"])
+	assert.Equal(t, "nexus.example.org", resp.Data["tls_server_name"])
+	assert.Equal(t, "tls13", resp.Data["tls_min_version"])
+	assert.NotContains(t, resp.Data, "client_key")
+
+	// The client key is kept on update
+	resp, err = doAction(actionUpdate, configAdminPath, b, reqStorage, testData{
+		"tls_server_name":   "",
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	config, err := b.fetchAdminConfig(context.Background(), reqStorage, "")
+	require.NoError(t, err)
+	assert.Equal(t, clientKey, config.ClientKey)
+	assert.Empty(t, config.TLSServerName)
+}
@@ -0,0 +1,90 @@
+package nxr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// reservedHeaders are set by the client on every request and cannot be overridden
+var reservedHeaders = []string{"Authorization", "Content-Type", "Accept", "Host"}
+
+// proxyFunc returns the proxy selection of the connection with Nexus Repository: the
+// proxy_url (bypassed for the no_proxy hosts), or the proxy of the environment if not set
+func (c *adminConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		if c.NoProxy != "" {
+			return nil, errors.New(`"no_proxy" requires "proxy_url"`)
+		}
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if u, err := url.Parse(c.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf(`"proxy_url" "%s" is not an absolute URL`, c.ProxyURL)
+	}
+
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  c.ProxyURL,
+		HTTPSProxy: c.ProxyURL,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}, nil
+}
+
+// validateHeaders checks that the custom headers are valid and do not override the client's ones
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf(`"headers" name "%s" is not a valid header name`, name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf(`"headers" value of "%s" is not a valid header value`, name)
+		}
+		if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(name)) {
+			return fmt.Errorf(`"headers" cannot set the "%s" header`, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return nil
+}
+
+// headerTransport sets the custom headers on every request to Nexus Repository
+type headerTransport struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	r = r.Clone(r.Context())
+	for name, values := range t.headers {
+		r.Header[name] = values
+	}
+
+	return t.next.RoundTrip(r)
+}
+
+// callRecorder records the time of the last successful response of Nexus Repository
+type callRecorder struct {
+	last *atomic.Int64
+	next http.RoundTripper
+}
+
+func (t *callRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		t.last.Store(time.Now().UnixNano())
+	}
+
+	return resp, err
+}
@@ -0,0 +1,162 @@
+package nxr
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Transport(t *testing.T) {
+	t.Run("Transport_Proxy", testTransport_Proxy)
+	t.Run("Transport_ChangeUserPassword", testTransport_ChangeUserPassword)
+	t.Run("Transport_Headers_Fail", testTransport_Headers_Fail)
+	t.Run("Transport_ConfigAdmin", testTransport_ConfigAdmin)
+}
+
+func testTransport_Proxy(t *testing.T) {
+	// The proxy receives the requests to Nexus Repository, with the custom headers
+	var proxied *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer proxy.Close()
+
+	config := &adminConfig{
+		Username: testConfigAdminUsername,
+		Password: testConfigAdminPassword,
+		URL:      "http://nexus.example.org",
+		Timeout:  5,
+		ProxyURL: proxy.URL,
+		Headers:  map[string]string{"x-waf-token": "secret", "X-Forwarded-For": "10.0.0.1"},
+	}
+	require.NoError(t, verifyCredential(config))
+	require.NotNil(t, proxied)
+	assert.Equal(t, "nexus.example.org", proxied.Host)
+	assert.Equal(t, "secret", proxied.Header.Get("X-Waf-Token"))
+	assert.Equal(t, "10.0.0.1", proxied.Header.Get("X-Forwarded-For"))
+	username, _, ok := proxied.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, testConfigAdminUsername, username)
+
+	// The no_proxy hosts bypass the proxy
+	config.NoProxy = "localhost,.example.org"
+	proxyFunc, err := config.proxyFunc()
+	require.NoError(t, err)
+
+	for target, expected := range map[string]string{
+		"https://nexus.example.org/service/rest": "",
+		"https://nexus.example.com/service/rest": proxy.URL,
+	} {
+		u, err := url.Parse(target)
+		require.NoError(t, err)
+		proxyURL, err := proxyFunc(&http.Request{URL: u})
+		require.NoError(t, err)
+		if expected == "" {
+			assert.Nil(t, proxyURL, target)
+		} else {
+			assert.Equal(t, expected, proxyURL.String(), target)
+		}
+	}
+}
+
+func testTransport_ChangeUserPassword(t *testing.T) {
+	// The calls managing the users go through the client built from the configuration too
+	var proxied *http.Request
+	var body []byte
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	c, err := newClient(&adminConfig{
+		Username: testConfigAdminUsername,
+		Password: testConfigAdminPassword,
+		URL:      "http://nexus.example.org",
+		Timeout:  5,
+		ProxyURL: proxy.URL,
+		Headers:  map[string]string{"x-waf-token": "secret"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, c.changeUserPassword("v-ci", "p@ss"))
+	require.NotNil(t, proxied)
+	assert.Equal(t, http.MethodPut, proxied.Method)
+	assert.Equal(t, "/service/rest/v1/security/users/v-ci/change-password", proxied.URL.Path)
+	assert.Equal(t, "text/plain", proxied.Header.Get("Content-Type"))
+	assert.Equal(t, "secret", proxied.Header.Get("X-Waf-Token"))
+	assert.Equal(t, "p@ss", string(body))
+}
+
+func testTransport_Headers_Fail(t *testing.T) {
+	testCases := []struct {
+		config        adminConfig
+		expectedError string
+	}{
+		{
+			config:        adminConfig{Headers: map[string]string{"X Token": "secret"}},
+			expectedError: `"headers" name "X Token" is not a valid header name`,
+		},
+		{
+			config:        adminConfig{Headers: map[string]string{"X-Token": "line\nbreak"}},
+			expectedError: `"headers" value of "X-Token" is not a valid header value`,
+		},
+		{
+			config:        adminConfig{Headers: map[string]string{"authorization": "Bearer token"}},
+			expectedError: `"headers" cannot set the "Authorization" header`,
+		},
+		{
+			config:        adminConfig{ProxyURL: "proxy.example.org:3128"},
+			expectedError: `"proxy_url" "proxy.example.org:3128" is not an absolute URL`,
+		},
+		{
+			config:        adminConfig{NoProxy: "localhost"},
+			expectedError: `"no_proxy" requires "proxy_url"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		_, err := newHTTPClient(&tc.config)
+		assert.EqualError(t, err, tc.expectedError)
+	}
+}
+
+func testTransport_ConfigAdmin(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"headers":           "authorization=Bearer token",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"headers" cannot set the "Authorization" header`, resp.Error().Error())
+
+	resp, err = doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               testConfigAdminURL,
+		"verify_connection": false,
+		"proxy_url":         "http://proxy.example.org:3128",
+		"no_proxy":          "localhost",
+		"headers":           []string{"X-Waf-Token=secret", "X-Forwarded-Proto=https"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.org:3128", resp.Data["proxy_url"])
+	assert.Equal(t, "localhost", resp.Data["no_proxy"])
+	assert.Equal(t, []string{"X-Forwarded-Proto", "X-Waf-Token"}, resp.Data["headers"])
+}
@@ -0,0 +1,106 @@
+package nxr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	userCachePath = "cache/"
+)
+
+// cachedUser is a Nexus Repository user issued to a requester of a role,
+// shared by all the leases of the same requester until it expires
+type cachedUser struct {
+	nxrUser
+	Expiration time.Time `json:"expiration"`
+	Leases     int       `json:"leases"`
+}
+
+// userCachePrefix returns the storage prefix of the users cached for the requester of a role,
+// the requester is identified by its entity ID or, without entity, by its display name.
+// The users of another connection than the role's one (e.g. before it changed) are not reused.
+func userCachePrefix(roleName string, connection string, req *logical.Request) string {
+	requester := "entity:" + req.EntityID
+	if req.EntityID == "" {
+		requester = "display_name:" + req.DisplayName
+	}
+	if connection != "" {
+		requester += "@connection:" + connection
+	}
+	requesterHash := sha256.Sum256([]byte(requester))
+
+	return fmt.Sprintf("%s%s/%s/", userCachePath, roleName, hex.EncodeToString(requesterHash[:]))
+}
+
+// getCachedUser returns the first non-expired user cached under the prefix, if any
+func getCachedUser(ctx context.Context, s logical.Storage, prefix string) (*cachedUser, string, error) {
+	userIDs, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		user, err := readCachedUser(ctx, s, prefix+userID)
+		if err != nil {
+			return nil, "", err
+		}
+		if user != nil && now.Before(user.Expiration) {
+			return user, prefix + userID, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// readCachedUser reads a cached user from the Vault storage API
+func readCachedUser(ctx context.Context, s logical.Storage, key string) (*cachedUser, error) {
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var user cachedUser
+	if err := entry.DecodeJSON(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setCachedUser adds a cached user to the Vault storage API
+func setCachedUser(ctx context.Context, s logical.Storage, key string, user *cachedUser) error {
+	entry, err := logical.StorageEntryJSON(key, user)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// releaseCachedUser drops a lease of a cached user, it returns true
+// if the user is still used by other leases and must be kept
+func releaseCachedUser(ctx context.Context, s logical.Storage, key string) (bool, error) {
+	user, err := readCachedUser(ctx, s, key)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, nil
+	}
+
+	user.Leases--
+	if user.Leases > 0 {
+		return true, setCachedUser(ctx, s, key, user)
+	}
+
+	return false, s.Delete(ctx, key)
+}
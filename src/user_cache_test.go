@@ -0,0 +1,89 @@
+package nxr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+func Test_UserCache(t *testing.T) {
+	t.Run("UserCache_WithMockApi", testUserCache_WithMockApi)
+}
+
+func doCredsActionAs(entityID string, b logical.Backend, s logical.Storage) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: actionRead,
+		Path:      testCredsPath,
+		Storage:   s,
+		EntityID:  entityID,
+	})
+}
+
+func testUserCache_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		// One user per requester
+		s.ExpectPost(userCreateURI).
+			ReturnCode(httpmock.StatusOK).
+			Twice()
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles": testRoleNexusRoles,
+		"ttl":         60,
+		"max_ttl":     3600,
+		"cache":       true,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The same requester gets the same user
+	first, err := doCredsActionAs("entity-a", b, reqStorage)
+	require.NoError(t, err)
+	require.NoError(t, first.Error())
+
+	second, err := doCredsActionAs("entity-a", b, reqStorage)
+	require.NoError(t, err)
+	require.NoError(t, second.Error())
+
+	assert.Equal(t, first.Data["user_id"], second.Data["user_id"])
+	assert.Equal(t, first.Data["password"], second.Data["password"])
+	assert.LessOrEqual(t, second.Secret.MaxTTL.Seconds(), float64(3600))
+
+	// Another requester gets its own user
+	other, err := doCredsActionAs("entity-b", b, reqStorage)
+	require.NoError(t, err)
+	require.NoError(t, other.Error())
+	assert.NotEqual(t, first.Data["user_id"], other.Data["user_id"])
+
+	// The user is kept while a lease still uses it
+	resp, err = doSecretAction(actionRevoke, first.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The user is deleted with its last lease
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, second.Data["user_id"]))
+	resp, err = doSecretAction(actionRevoke, second.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	keys, err := reqStorage.List(context.Background(), userCachePrefix(testRoleName, "", &logical.Request{EntityID: "entity-a"}))
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,65 @@
+package nxr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
+)
+
+const (
+	// the endpoint used by the Nexus Repository UI to access the user token of the current user
+	userTokenEndpoint = client.BasePath + "internal/current-user/user-token"
+)
+
+// userToken is a Nexus Repository Pro user token, used by
+// build tools in place of the user's name and password
+type userToken struct {
+	NameCode string `json:"nameCode"`
+	PassCode string `json:"passCode"`
+}
+
+// issueUserToken returns the user token of the user, it is created on first access.
+func issueUserToken(config *adminConfig, userID string, password string) (*userToken, error) {
+	c, err := newUserClient(config, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.currentUserToken(userID, password)
+	if err != nil {
+		return nil, fmt.Errorf("could not get user token of user '%s': %w", userID, err)
+	}
+
+	return token, nil
+}
+
+// currentUserToken returns the user token of the client's user
+func (c *nxrClient) currentUserToken(userID string, password string) (*userToken, error) {
+	authToken, err := c.authenticationToken(userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	body, resp, err := c.get(fmt.Sprintf("%s?authToken=%s", userTokenEndpoint, url.QueryEscape(authToken)))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var token userToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("could not unmarshal user token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// resetUserToken invalidates the user token of the user, a new one is created on next access
+func (c *nxrClient) resetUserToken(userID string) error {
+	return c.delete(fmt.Sprintf("%s/%s/user-token", securityUsersEndpoint, url.PathEscape(userID)))
+}
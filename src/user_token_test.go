@@ -0,0 +1,195 @@
+package nxr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	authenticateURI      = "/service/rest/wonderland/authenticate"
+	userTokenURIRegex    = `^/service/rest/internal/current-user/user-token\?authToken=`
+	userTokenResetURI    = "/service/rest/v1/security/users/%s/user-token"
+	testUserTokenName    = "Z8o6W3Gn"
+	testUserTokenPass    = "tP5pW3ejkaNH1xJHEv3Kw0bdkE8ZOvmtfk0S82Qfv5eX"
+	testUserTokenAuthRsp = `{"t":"dGVzdA=="}`
+)
+
+func Test_UserToken(t *testing.T) {
+	t.Run("UserToken_Creds_WithMockApi", testUserToken_Creds_WithMockApi)
+	t.Run("UserToken_StaticRole_WithMockApi", testUserToken_StaticRole_WithMockApi)
+	t.Run("UserToken_Revoke_Disable_WithMockApi", testUserToken_Revoke_Disable_WithMockApi)
+	t.Run("UserToken_Fail", testUserToken_Fail)
+}
+
+// expectUserToken mocks the access to the user token of the current user
+func expectUserToken(s *httpmock.Server) {
+	s.ExpectPost(authenticateURI).
+		Return(testUserTokenAuthRsp)
+	s.ExpectGet(httpmock.RegexPattern(userTokenURIRegex)).
+		ReturnJSON(userToken{NameCode: testUserTokenName, PassCode: testUserTokenPass})
+}
+
+func testUserToken_Creds_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		expectUserToken(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeUserToken,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testUserTokenName, resp.Data["name_code"])
+	assert.Equal(t, testUserTokenPass, resp.Data["pass_code"])
+	assert.NotContains(t, resp.Data, "password")
+
+	// The token is deleted along with the user
+	mockSrv.ExpectDelete(fmt.Sprintf(userURI, resp.Data["user_id"]))
+	resp, err = doSecretAction(actionRevoke, resp.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testUserToken_StaticRole_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPut(fmt.Sprintf(userChangePasswordURI, testStaticRoleUserID))
+		s.ExpectDelete(fmt.Sprintf(userTokenResetURI, testStaticRoleUserID)).
+			ReturnCode(httpmock.StatusNoContent)
+		expectUserToken(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, staticRolesPath+testStaticRoleName, b, reqStorage, testData{
+		"user_id":         testStaticRoleUserID,
+		"credential_type": credentialTypeUserToken,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, staticCredsPath+testStaticRoleName, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Error())
+	assert.Equal(t, testStaticRoleUserID, resp.Data["user_id"])
+	assert.Equal(t, testUserTokenName, resp.Data["name_code"])
+	assert.Equal(t, testUserTokenPass, resp.Data["pass_code"])
+	assert.NotContains(t, resp.Data, "password")
+}
+
+func testUserToken_Revoke_Disable_WithMockApi(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		expectUserToken(s)
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeUserToken,
+		"revocation_mode": revocationModeDisable,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	creds, err := doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	require.NoError(t, creds.Error())
+	userID := creds.Data["user_id"].(string)
+
+	// The user token is reset before the user is disabled, it would be valid again if the user was re-enabled
+	mockSrv.ExpectDelete(fmt.Sprintf(userTokenResetURI, userID)).
+		ReturnCode(httpmock.StatusNoContent)
+	mockSrv.ExpectGet(fmt.Sprintf(userGetURI, userID)).
+		Run(returnRequestedUser)
+	mockSrv.ExpectPut(fmt.Sprintf(userURI, userID))
+
+	resp, err = doSecretAction(actionRevoke, creds.Secret, b, reqStorage)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func testUserToken_Fail(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	mockSrv := httpmock.New(func(s *httpmock.Server) {
+		s.ExpectPost(userCreateURI)
+		// Nexus Repository OSS, or the user token realm is not enabled
+		s.ExpectPost(authenticateURI).
+			Return(testUserTokenAuthRsp)
+		s.ExpectGet(httpmock.RegexPattern(userTokenURIRegex)).
+			ReturnCode(httpmock.StatusNotFound)
+		// The user is rolled back
+		s.ExpectDelete(httpmock.RegexPattern(`^/service/rest/v1/security/users/v-test-role-`))
+	})(t)
+
+	resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+		"username":          testConfigAdminUsername,
+		"password":          testConfigAdminPassword,
+		"url":               mockSrv.URL(),
+		"verify_connection": false,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Unknown credential type
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": "api_key",
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, `"credential_type" must be one of "password", "user_token" or "nuget_api_key"`, resp.Error().Error())
+
+	resp, err = doAction(actionCreate, rolesPath+testRoleName, b, reqStorage, testData{
+		"nexus_roles":     testRoleNexusRoles,
+		"credential_type": credentialTypeUserToken,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = doAction(actionRead, testCredsPath, b, reqStorage, nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "could not get user token of Nexus Repository user")
+}
@@ -0,0 +1,136 @@
+package nxr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/pkg/client"
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+)
+
+const (
+	currentUserEndpoint = client.BasePath + "internal/ui/user"
+)
+
+var (
+	// requiredPrivileges are the privileges the admin user needs to manage the generated users
+	requiredPrivileges = []string{"nx-users-create", "nx-users-delete", "nx-userschangepw"}
+
+	// allUsersPrivileges grant all the required privileges
+	allUsersPrivileges = []string{"nx-all", "nx-users-all"}
+)
+
+// currentUser is the user authenticated by the current-user endpoint
+type currentUser struct {
+	ID            string `json:"id"`
+	Administrator bool   `json:"administrator"`
+}
+
+// verifyConnection checks that Nexus Repository is reachable, that the admin credential
+// authenticates, and that the admin user holds the privileges required to manage users.
+// The privileges which cannot be read (e.g. roles of an external realm) are returned as a warning.
+func verifyConnection(config *adminConfig) ([]string, error) {
+	c, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.status(); err != nil {
+		return nil, fmt.Errorf("Nexus Repository is not reachable at '%s': %w", config.URL, err)
+	}
+
+	var user currentUser
+	err = c.getJSON(currentUserEndpoint, &user)
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("could not authenticate as user '%s': wrong username or password", config.Username)
+	case err != nil:
+		return nil, fmt.Errorf("could not authenticate as user '%s': %w", config.Username, err)
+	}
+	if user.Administrator {
+		return nil, nil
+	}
+
+	privileges, err := c.userPrivileges(config.Username)
+	if err != nil {
+		return []string{fmt.Sprintf("could not verify the privileges of user '%s', it must hold %s (or %s): %s",
+			config.Username, strings.Join(requiredPrivileges, ", "), allUsersPrivileges[1], err)}, nil
+	}
+
+	if missing := missingPrivileges(privileges); len(missing) > 0 {
+		return nil, fmt.Errorf("user '%s' is missing the privileges: %s (or %s)", config.Username, strings.Join(missing, ", "), allUsersPrivileges[1])
+	}
+
+	return nil, nil
+}
+
+// missingPrivileges returns the required privileges which are not granted
+func missingPrivileges(privileges []string) []string {
+	for _, p := range allUsersPrivileges {
+		if slices.Contains(privileges, p) {
+			return nil
+		}
+	}
+
+	var missing []string
+	for _, p := range requiredPrivileges {
+		if !slices.Contains(privileges, p) {
+			missing = append(missing, p)
+		}
+	}
+
+	return missing
+}
+
+// userPrivileges returns the privileges granted to the user through its roles, nested roles included
+func (c *nxrClient) userPrivileges(userID string) ([]string, error) {
+	var users []security.User
+	if err := c.getJSON(fmt.Sprintf("%s?userId=%s", securityUsersEndpoint, url.QueryEscape(userID)), &users); err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(users, func(u security.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return nil, fmt.Errorf("user '%s' not found", userID)
+	}
+
+	var privileges []string
+	seen := map[string]bool{}
+	roleIDs := slices.Clone(users[i].Roles)
+	for len(roleIDs) > 0 {
+		roleID := roleIDs[0]
+		roleIDs = roleIDs[1:]
+		if seen[roleID] {
+			continue
+		}
+		seen[roleID] = true
+
+		var role security.Role
+		if err := c.getJSON(fmt.Sprintf("%s/%s", securityRolesEndpoint, url.PathEscape(roleID)), &role); err != nil {
+			return nil, err
+		}
+		privileges = append(privileges, role.Privileges...)
+		roleIDs = append(roleIDs, role.Roles...)
+	}
+
+	return privileges, nil
+}
+
+// getJSON gets a resource of the API, an unexpected response is returned as an *apiError
+func (c *nxrClient) getJSON(endpoint string, v interface{}) error {
+	body, resp, err := c.get(endpoint)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return json.Unmarshal(body, v)
+}
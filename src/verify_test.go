@@ -0,0 +1,209 @@
+package nxr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/datadrivers/go-nexus-client/nexus3/schema/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.nhat.io/httpmock"
+)
+
+const (
+	statusURI      = "/service/rest/v1/status"
+	currentUserURI = "/service/rest/internal/ui/user"
+)
+
+func Test_VerifyConnection(t *testing.T) {
+	t.Run("VerifyConnection_WithMockApi", testVerifyConnection_WithMockApi)
+	t.Run("VerifyConnection_WithMockApi_Warning", testVerifyConnection_WithMockApi_Warning)
+	t.Run("VerifyConnection_WithMockApi_Fail", testVerifyConnection_WithMockApi_Fail)
+}
+
+// expectCurrentUser mocks the status and the current-user endpoints
+func expectCurrentUser(s *httpmock.Server, administrator bool) {
+	s.ExpectGet(statusURI)
+	s.ExpectGet(currentUserURI).
+		ReturnJSON(currentUser{ID: testConfigAdminUsername, Administrator: administrator})
+}
+
+// expectAdminRoles mocks the lookup of the admin user and of its roles
+func expectAdminRoles(s *httpmock.Server, roles ...security.Role) {
+	expectCurrentUser(s, false)
+	s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+		ReturnJSON([]security.User{{UserID: testConfigAdminUsername, Roles: []string{roles[0].ID}}})
+	for _, role := range roles {
+		s.ExpectGet(fmt.Sprintf(roleURI, role.ID)).
+			ReturnJSON(role)
+	}
+}
+
+func testVerifyConnection_WithMockApi(t *testing.T) {
+	testCases := []struct {
+		name  string
+		roles []security.Role
+	}{
+		{
+			name: "administrator",
+		},
+		{
+			name:  "admin",
+			roles: []security.Role{{ID: "nx-admin", Privileges: []string{"nx-all"}}},
+		},
+		{
+			name:  "all users privileges",
+			roles: []security.Role{{ID: "vault", Privileges: []string{"nx-users-all", "nx-roles-read"}}},
+		},
+		{
+			name: "nested roles",
+			roles: []security.Role{
+				{ID: "vault", Privileges: []string{"nx-users-create"}, Roles: []string{"vault-delete"}},
+				{ID: "vault-delete", Privileges: []string{"nx-users-delete"}, Roles: []string{"vault", "vault-password"}},
+				{ID: "vault-password", Privileges: []string{"nx-userschangepw"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+
+			mockSrv := httpmock.New(func(s *httpmock.Server) {
+				if len(tc.roles) == 0 {
+					expectCurrentUser(s, true)
+					return
+				}
+				expectAdminRoles(s, tc.roles...)
+			})(t)
+
+			resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+				"username": testConfigAdminUsername,
+				"password": testConfigAdminPassword,
+				"url":      mockSrv.URL(),
+			})
+			require.NoError(t, err)
+			assert.Nil(t, resp)
+		})
+	}
+}
+
+func testVerifyConnection_WithMockApi_Warning(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mockServer      httpmock.Mocker
+		expectedWarning string
+	}{
+		{
+			name: "forbidden lookup",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				expectCurrentUser(s, false)
+				s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+					ReturnCode(httpmock.StatusForbidden)
+			}),
+			expectedWarning: "could not verify the privileges of user 'admin', it must hold nx-users-create, nx-users-delete, nx-userschangepw (or nx-users-all): HTTP: 403",
+		},
+		{
+			name: "external user",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				expectCurrentUser(s, false)
+				s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+					ReturnJSON([]security.User{})
+			}),
+			expectedWarning: "could not verify the privileges of user 'admin', it must hold nx-users-create, nx-users-delete, nx-userschangepw (or nx-users-all): user 'admin' not found",
+		},
+		{
+			name: "external role",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				expectCurrentUser(s, false)
+				s.ExpectGet(fmt.Sprintf(userGetURI, testConfigAdminUsername)).
+					ReturnJSON([]security.User{{UserID: testConfigAdminUsername, Roles: []string{"ldap-admins"}}})
+				s.ExpectGet(fmt.Sprintf(roleURI, "ldap-admins")).
+					ReturnCode(httpmock.StatusNotFound)
+			}),
+			expectedWarning: "could not verify the privileges of user 'admin', it must hold nx-users-create, nx-users-delete, nx-userschangepw (or nx-users-all): HTTP: 404",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+			mockSrv := tc.mockServer(t)
+
+			resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+				"username": testConfigAdminUsername,
+				"password": testConfigAdminPassword,
+				"url":      mockSrv.URL(),
+			})
+			require.NoError(t, err)
+			require.NoError(t, resp.Error())
+			require.Len(t, resp.Warnings, 1)
+			assert.Contains(t, resp.Warnings[0], tc.expectedWarning)
+
+			// The configuration is stored
+			resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+			require.NoError(t, err)
+			require.NoError(t, resp.Error())
+			assert.Equal(t, testConfigAdminUsername, resp.Data["username"])
+		})
+	}
+}
+
+func testVerifyConnection_WithMockApi_Fail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mockServer    httpmock.Mocker
+		expectedError string
+	}{
+		{
+			name: "unreachable",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				s.ExpectGet(statusURI).
+					ReturnCode(httpmock.StatusServiceUnavailable)
+			}),
+			expectedError: "Nexus Repository is not reachable at '<url>': HTTP: 503",
+		},
+		{
+			name: "wrong password",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				s.ExpectGet(statusURI)
+				s.ExpectGet(currentUserURI).
+					ReturnCode(httpmock.StatusUnauthorized)
+			}),
+			expectedError: "could not authenticate as user 'admin': wrong username or password",
+		},
+		{
+			name: "missing privileges",
+			mockServer: httpmock.New(func(s *httpmock.Server) {
+				expectAdminRoles(s,
+					security.Role{ID: "vault", Privileges: []string{"nx-users-create", "nx-users-read"}, Roles: []string{"viewer"}},
+					security.Role{ID: "viewer", Privileges: []string{"nx-roles-read"}},
+				)
+			}),
+			expectedError: "user 'admin' is missing the privileges: nx-users-delete, nx-userschangepw (or nx-users-all)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+			mockSrv := tc.mockServer(t)
+
+			resp, err := doAction(actionCreate, configAdminPath, b, reqStorage, testData{
+				"username": testConfigAdminUsername,
+				"password": testConfigAdminPassword,
+				"url":      mockSrv.URL(),
+			})
+			require.NoError(t, err)
+			assert.True(t, resp.IsError())
+			assert.Contains(t, resp.Error().Error(), strings.ReplaceAll(tc.expectedError, "<url>", mockSrv.URL()))
+
+			// Nothing is stored
+			resp, err = doAction(actionRead, configAdminPath, b, reqStorage, nil)
+			require.NoError(t, err)
+			assert.True(t, resp.IsError())
+		})
+	}
+}